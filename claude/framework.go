@@ -8,19 +8,26 @@ import (
 	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"os"
 	"path"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	restate "github.com/restatedev/sdk-go"
 	"github.com/restatedev/sdk-go/ingress"
+	"gopkg.in/yaml.v3"
 )
 
 // -----------------------------------------------------------------------------
@@ -381,6 +388,7 @@ func RejectExternalSignal(ctx restate.Context, id string, reason error) {
 }
 
 // GetInternalSignal obtains a durable promise for intra-workflow coordination.
+// A promise resolves once; use a Mailbox for repeated signals.
 func GetInternalSignal[T any](ctx restate.WorkflowSharedContext, name string) restate.DurablePromise[T] {
 	ctx.Log().Info("framework: getting internal signal (promise)", "name", name)
 	return restate.Promise[T](ctx, name)
@@ -507,7 +515,7 @@ func RacePromiseWithTimeout[T any](
 
 // RaceAwakeableWithTimeout races an awakeable against a timeout (standalone generic function)
 func RaceAwakeableWithTimeout[T any](
-	ctx restate.WorkflowContext,
+	ctx restate.Context,
 	awakeable restate.AwakeableFuture[T],
 	timeout time.Duration,
 	timeoutValue T,
@@ -518,30 +526,55 @@ func RaceAwakeableWithTimeout[T any](
 		"awakeable_id", awakeable.Id(),
 		"timeout", timeout.String())
 
-	winner, err := restate.WaitFirst(ctx, awakeable, timeoutFuture)
+	_, value, timedOut, err := raceAwakeables(ctx, []restate.AwakeableFuture[T]{awakeable}, timeoutFuture)
 	if err != nil {
 		return timeoutValue, false, err
 	}
-
-	switch winner {
-	case timeoutFuture:
-		if err := timeoutFuture.Done(); err != nil {
-			return timeoutValue, false, err
-		}
+	if timedOut {
 		ctx.Log().Warn("workflow: awakeable timed out")
 		return timeoutValue, true, nil
+	}
+	ctx.Log().Info("workflow: awakeable completed before timeout")
+	return value, false, nil
+}
 
-	case awakeable:
-		value, err := awakeable.Result()
-		if err != nil {
-			return timeoutValue, false, err
+// raceAwakeables waits for the first of awakeables to complete, or for timer
+// when it is not nil. It returns the index and value of the awakeable that
+// won, or timedOut when the timer fired first.
+func raceAwakeables[T any](
+	ctx restate.Context,
+	awakeables []restate.AwakeableFuture[T],
+	timer restate.AfterFuture,
+) (int, T, bool, error) {
+	var zero T
+	futures := make([]restate.Future, 0, len(awakeables)+1)
+	for _, a := range awakeables {
+		futures = append(futures, a)
+	}
+	if timer != nil {
+		futures = append(futures, timer)
+	}
+
+	winner, err := restate.WaitFirst(ctx, futures...)
+	if err != nil {
+		return -1, zero, false, err
+	}
+	if timer != nil && winner == restate.Future(timer) {
+		if err := timer.Done(); err != nil {
+			return -1, zero, false, err
 		}
-		ctx.Log().Info("workflow: awakeable completed before timeout")
-		return value, false, nil
+		return -1, zero, true, nil
+	}
 
-	default:
-		return timeoutValue, false, fmt.Errorf("unexpected race winner")
+	idx := futureIndex(futures, winner)
+	if idx < 0 {
+		return -1, zero, false, fmt.Errorf("unexpected race winner")
 	}
+	value, err := awakeables[idx].Result()
+	if err != nil {
+		return idx, zero, false, err
+	}
+	return idx, value, false, nil
 }
 
 // WorkflowStatus provides utilities for exposing workflow progress via shared handlers
@@ -571,6 +604,18 @@ type StatusData struct {
 	UpdatedAt      time.Time              `json:"updated_at"`
 	IsComplete     bool                   `json:"is_complete"`
 	Error          string                 `json:"error,omitempty"`
+	History        []StatusTransition     `json:"history,omitempty"` // oldest first, bounded
+	Version        int                    `json:"version,omitempty"` // bumped by every ProgressTracker write
+}
+
+// StatusTransition is one entry of the progress history kept by ProgressTracker.
+type StatusTransition struct {
+	At       time.Time `json:"at"`
+	Event    string    `json:"event"` // started, step_started, step_completed, step_failed, iteration, phase, completed, failed
+	Step     string    `json:"step,omitempty"`
+	Phase    string    `json:"phase,omitempty"`
+	Progress float64   `json:"progress"`
+	Error    string    `json:"error,omitempty"`
 }
 
 // GetStatus retrieves current workflow status (read-only, safe from shared context)
@@ -582,6 +627,53 @@ func (ws *WorkflowStatus) GetStatus() (StatusData, error) {
 	return status, nil
 }
 
+// StatusWaitRequest is the input of a workflow's WaitStatus shared handler.
+type StatusWaitRequest struct {
+	// After is the last StatusData.Version the caller has seen
+	After int `json:"after"`
+
+	// Timeout bounds the wait; the unchanged status is returned when it
+	// elapses. Zero waits until the status changes.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// WaitStatus blocks until ProgressTracker writes a status newer than
+// req.After and returns it. A newer or final status is returned at once.
+// Expose it as a shared handler for StatusStreamHandler:
+//
+//	func (OrderWorkflow) WaitStatus(ctx restate.WorkflowSharedContext, req framework.StatusWaitRequest) (framework.StatusData, error) {
+//	    return framework.NewWorkflowStatus(ctx, "").WaitStatus(req)
+//	}
+//
+// Every status ProgressTracker persists resolves the durable promise of its
+// version, which is what the handler waits on.
+func (ws *WorkflowStatus) WaitStatus(req StatusWaitRequest) (StatusData, error) {
+	status, err := ws.GetStatus()
+	if err != nil || status.Version > req.After || status.IsComplete || status.Error != "" {
+		return status, err
+	}
+
+	promise := restate.Promise[StatusData](ws.ctx, statusPromiseName(ws.stateKey, req.After+1))
+	if req.Timeout <= 0 {
+		return promise.Result()
+	}
+	timer := restate.After(ws.ctx, req.Timeout)
+	winner, err := restate.WaitFirst(ws.ctx, promise, timer)
+	if err != nil {
+		return status, err
+	}
+	if winner == timer {
+		return status, nil
+	}
+	return promise.Result()
+}
+
+// statusPromiseName names the durable promise resolved with version of the
+// status stored under statusKey.
+func statusPromiseName(statusKey string, version int) string {
+	return fmt.Sprintf("%s:v%d", statusKey, version)
+}
+
 // UpdateStatus updates workflow status (must be called from exclusive run handler)
 func UpdateStatus(ctx restate.WorkflowContext, statusKey string, update StatusData) error {
 	update.UpdatedAt = time.Now()
@@ -593,6 +685,320 @@ func UpdateStatus(ctx restate.WorkflowContext, statusKey string, update StatusDa
 	return nil
 }
 
+// ProgressTracker maintains a workflow's StatusData automatically. Once a
+// run handler calls TrackProgress, saga steps, ForEach items, WorkflowLoop
+// iterations and builder steps running in the same invocation update
+// CurrentStep, CompletedSteps and Progress, and every transition is
+// appended to a bounded History.
+//
+//	func (w OrderWorkflow) Run(ctx restate.WorkflowContext, order Order) (err error) {
+//	    tracker := framework.TrackProgress(ctx, "", framework.DefaultWorkflowConfig())
+//	    defer tracker.Finish(&err)
+//	    tracker.ExpectSteps(3)
+//	    ...
+//	}
+//
+// Status is written to durable state only with
+// WorkflowConfig.EnableStatusPersistence on; otherwise it is available
+// through Status inside the invocation and GetStatus reports nothing.
+// Each persisted status also resolves a durable promise named after its
+// Version, which WorkflowStatus.WaitStatus blocks on; the promises are kept
+// until the workflow's retention expires, like its state.
+//
+// Steps, phases and the final outcome are written as they happen. Loop and
+// ForEach iterations are coalesced: the status is written every
+// progressIterationStride items, or every 5% of a ForEach, so a long loop
+// does not add a state write per item to the journal. A persisted write
+// takes its timestamp from a journaled clock, so it costs
+// progressWriteEntries journal entries; without persistence the timestamps
+// come from the wall clock and stay in memory.
+type ProgressTracker struct {
+	ctx        restate.WorkflowContext
+	invocation string
+	key        string
+	persist    bool
+	limit      int
+	total      int
+	open       map[string]int
+	status     StatusData
+}
+
+var (
+	progressTrackersMu sync.Mutex
+	progressTrackers   = make(map[string]*ProgressTracker)
+)
+
+// progressIterationStride is how many iterations of a loop without a known
+// length are coalesced into one status write.
+const progressIterationStride = 50
+
+// progressWriteEntries is the journal cost of a persisted status write: the
+// clock Run, the state write and the status promise.
+const progressWriteEntries = 3
+
+// iterationStride returns how many items of a run of total pass between
+// status writes: every 5% of a known total, progressIterationStride
+// otherwise.
+func iterationStride(total int) int {
+	if total <= 0 {
+		return progressIterationStride
+	}
+	if stride := total / 20; stride > 1 {
+		return stride
+	}
+	return 1
+}
+
+// TrackProgress starts automatic progress tracking for this invocation and
+// returns the tracker. Defer Finish so the final state is recorded and the
+// tracker is released. An empty statusKey uses "workflow_status".
+func TrackProgress(ctx restate.WorkflowContext, statusKey string, cfg WorkflowConfig) *ProgressTracker {
+	if statusKey == "" {
+		statusKey = "workflow_status"
+	}
+	limit := cfg.StatusHistoryLimit
+	if limit <= 0 {
+		limit = 50
+	}
+	t := &ProgressTracker{
+		ctx:        ctx,
+		invocation: hex.EncodeToString(ctx.Request().ID),
+		key:        statusKey,
+		persist:    cfg.EnableStatusPersistence,
+		limit:      limit,
+		open:       make(map[string]int),
+		status:     StatusData{CompletedSteps: []string{}, Metadata: map[string]interface{}{}},
+	}
+
+	if t.persist {
+		// Versions name status promises, so a later tracker of the same run
+		// continues where the previous one stopped
+		if prev, err := restate.Get[StatusData](ctx, statusKey); err == nil {
+			t.status.Version = prev.Version
+		}
+	}
+
+	progressTrackersMu.Lock()
+	progressTrackers[t.invocation] = t
+	progressTrackersMu.Unlock()
+
+	t.record(StatusTransition{Event: "started"})
+	return t
+}
+
+// progressFor returns the tracker of the invocation ctx belongs to, or nil.
+// All ProgressTracker methods are no-ops on nil.
+func progressFor(ctx restate.Context) *ProgressTracker {
+	if ctx == nil {
+		return nil
+	}
+	progressTrackersMu.Lock()
+	defer progressTrackersMu.Unlock()
+	return progressTrackers[hex.EncodeToString(ctx.Request().ID)]
+}
+
+// ensureProgress reuses the invocation's tracker or starts one. owned
+// reports whether the caller started it and must Finish it.
+func ensureProgress(ctx restate.WorkflowContext, statusKey string, cfg WorkflowConfig) (t *ProgressTracker, owned bool) {
+	if t := progressFor(ctx); t != nil {
+		return t, false
+	}
+	return TrackProgress(ctx, statusKey, cfg), true
+}
+
+// ExpectSteps sets the number of steps the workflow will complete, so
+// Progress follows CompletedSteps. Without it, Progress follows ForEach items.
+func (t *ProgressTracker) ExpectSteps(n int) {
+	if t == nil {
+		return
+	}
+	t.total = n
+}
+
+// Annotate sets a metadata entry on the status.
+func (t *ProgressTracker) Annotate(key string, value interface{}) {
+	if t == nil {
+		return
+	}
+	t.status.Metadata[key] = value
+	t.write()
+}
+
+// SetPhase reports a phase that is not tied to a step.
+func (t *ProgressTracker) SetPhase(phase string) {
+	if t == nil || t.status.Phase == phase {
+		return
+	}
+	t.status.Phase = phase
+	t.record(StatusTransition{Event: "phase"})
+}
+
+// StepStarted makes name the current step. phase defaults to name. Starting
+// the step that is already current is ignored, so a builder step and the
+// saga step behind it are reported once.
+func (t *ProgressTracker) StepStarted(name, phase string) {
+	if t == nil || (t.status.CurrentStep == name && t.open[name] > 0) {
+		return
+	}
+	if phase == "" {
+		phase = name
+	}
+	t.open[name]++
+	t.status.CurrentStep = name
+	t.status.Phase = phase
+	t.record(StatusTransition{Event: "step_started", Step: name})
+}
+
+// StepCompleted appends name to CompletedSteps. A repeated completion of a
+// step that was not started again is ignored.
+func (t *ProgressTracker) StepCompleted(name string) {
+	if t == nil {
+		return
+	}
+	if t.open[name] > 0 {
+		t.open[name]--
+	} else if n := len(t.status.CompletedSteps); n > 0 && t.status.CompletedSteps[n-1] == name {
+		return
+	}
+	t.status.CompletedSteps = append(t.status.CompletedSteps, name)
+	if t.status.CurrentStep == name {
+		t.status.CurrentStep = ""
+	}
+	if t.total > 0 {
+		t.status.Progress = math.Min(1, float64(len(t.status.CompletedSteps))/float64(t.total))
+	}
+	t.record(StatusTransition{Event: "step_completed", Step: name})
+}
+
+// StepFailed records that a step failed.
+func (t *ProgressTracker) StepFailed(name string, err error) {
+	if t == nil {
+		return
+	}
+	if t.open[name] > 0 {
+		t.open[name]--
+	}
+	tr := StatusTransition{Event: "step_failed", Step: name}
+	if err != nil {
+		tr.Error = err.Error()
+	}
+	t.record(tr)
+}
+
+// Iteration reports that item index (zero-based) of scope finished. When no
+// step count is expected, Progress follows the items. written reports
+// whether this item caused a state write.
+func (t *ProgressTracker) Iteration(scope string, index, total int) (written bool) {
+	if t == nil {
+		return false
+	}
+	t.status.CurrentStep = fmt.Sprintf("%s[%d]", scope, index)
+	if t.total == 0 && total > 0 {
+		t.status.Progress = float64(index+1) / float64(total)
+	}
+	// Intermediate items only update memory; the next write carries them
+	if index > 0 && index+1 != total && (index+1)%iterationStride(total) != 0 {
+		return false
+	}
+	t.record(StatusTransition{Event: "iteration", Step: t.status.CurrentStep})
+	return t.persist
+}
+
+// Status returns a copy of the current status.
+func (t *ProgressTracker) Status() StatusData {
+	if t == nil {
+		return StatusData{}
+	}
+	status := t.status
+	status.CompletedSteps = append([]string(nil), t.status.CompletedSteps...)
+	status.History = append([]StatusTransition(nil), t.status.History...)
+	return status
+}
+
+// Finish records completion or, when *errPtr is set, failure, then releases
+// the tracker. Defer it right after TrackProgress.
+func (t *ProgressTracker) Finish(errPtr *error) {
+	if t == nil {
+		return
+	}
+	// The SDK unwinds suspended invocations with a panic; leave the status
+	// alone so the resumed invocation carries on from the journal
+	if r := recover(); r != nil {
+		t.release()
+		panic(r)
+	}
+	defer t.release()
+
+	t.status.CurrentStep = ""
+	if errPtr != nil && *errPtr != nil {
+		t.status.Error = (*errPtr).Error()
+		t.status.Phase = "failed"
+		t.record(StatusTransition{Event: "failed", Error: t.status.Error})
+		return
+	}
+	t.status.Phase = "completed"
+	t.status.Progress = 1
+	t.status.IsComplete = true
+	t.record(StatusTransition{Event: "completed"})
+}
+
+func (t *ProgressTracker) release() {
+	progressTrackersMu.Lock()
+	defer progressTrackersMu.Unlock()
+	if progressTrackers[t.invocation] == t {
+		delete(progressTrackers, t.invocation)
+	}
+}
+
+// record appends tr to History and writes the status, which stamps tr.
+func (t *ProgressTracker) record(tr StatusTransition) {
+	if tr.Phase == "" {
+		tr.Phase = t.status.Phase
+	}
+	tr.Progress = t.status.Progress
+	t.status.History = append(t.status.History, tr)
+	if over := len(t.status.History) - t.limit; over > 0 {
+		t.status.History = append([]StatusTransition(nil), t.status.History[over:]...)
+	}
+	t.write()
+}
+
+// write stamps the status, and a transition recorded just before it, then
+// persists it when enabled.
+func (t *ProgressTracker) write() {
+	now := t.now()
+	t.status.UpdatedAt = now
+	if n := len(t.status.History); n > 0 && t.status.History[n-1].At.IsZero() {
+		t.status.History[n-1].At = now
+	}
+	if !t.persist {
+		return
+	}
+	t.status.Version++
+	restate.Set(t.ctx, t.key, t.status)
+	// Wakes WaitStatus callers blocked on this version
+	promise := restate.Promise[StatusData](t.ctx, statusPromiseName(t.key, t.status.Version))
+	if err := promise.Resolve(t.status); err != nil {
+		t.ctx.Log().Warn("workflow: status promise not resolved", "version", t.status.Version, "error", err.Error())
+	}
+}
+
+// now reads the clock for a status write. A persisted status goes into the
+// journal, so its time must replay identically.
+func (t *ProgressTracker) now() time.Time {
+	if !t.persist {
+		return time.Now()
+	}
+	now, err := RunDo(t.ctx, func(rc restate.RunContext) (time.Time, error) {
+		return time.Now(), nil
+	}, restate.WithName("progress.now"))
+	if err != nil {
+		t.ctx.Log().Warn("workflow: status clock failed", "error", err.Error())
+		return t.status.UpdatedAt
+	}
+	return now
+}
+
 // LoopCondition is a function that determines if loop should continue
 type LoopCondition func() (shouldContinue bool, err error)
 
@@ -618,7 +1024,8 @@ func NewWorkflowLoop(ctx restate.WorkflowContext, maxIterations int) *WorkflowLo
 	}
 }
 
-// While executes body while condition returns true
+// While executes body while condition returns true. Every iteration stays
+// in the journal; loops that run indefinitely should use ContinuableLoop.
 func (wl *WorkflowLoop) While(condition LoopCondition, body LoopBody) error {
 	iteration := 0
 	for {
@@ -645,43 +1052,44 @@ func (wl *WorkflowLoop) While(condition LoopCondition, body LoopBody) error {
 		if err := body(iteration); err != nil {
 			return fmt.Errorf("loop body failed at iteration %d: %w", iteration, err)
 		}
+		progressFor(wl.ctx).Iteration("loop", iteration, 0)
 
 		iteration++
 	}
 	return nil
 }
 
-// Retry executes body with exponential backoff retry
+// Retry executes body with exponential backoff retry. Every error is
+// retried, terminal ones included; use RetryWithPolicy for finer control.
 func (wl *WorkflowLoop) Retry(body LoopBody, maxAttempts int, initialDelay time.Duration) error {
 	if maxAttempts <= 0 {
 		maxAttempts = 3
 	}
+	return wl.RetryWithPolicy(body, RetryPolicy{
+		MaxAttempts:  maxAttempts,
+		InitialDelay: initialDelay,
+		MaxDelay:     5 * time.Minute,
+		RetryOn:      func(error) bool { return true },
+	})
+}
 
-	var lastErr error
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		wl.log.Info("workflow: retry attempt", "attempt", attempt+1, "max", maxAttempts)
-
-		err := body(attempt)
-		if err == nil {
-			wl.log.Info("workflow: retry succeeded", "attempts", attempt+1)
-			return nil
-		}
-
-		lastErr = err
-		wl.log.Warn("workflow: retry attempt failed", "attempt", attempt+1, "error", err.Error())
-
-		// Don't sleep after last attempt
-		if attempt < maxAttempts-1 {
-			delay := computeBackoff(initialDelay, 5*time.Minute, attempt)
-			wl.log.Debug("workflow: retry backoff", "delay", delay.String())
-			if sleepErr := restate.Sleep(wl.ctx, delay); sleepErr != nil {
-				return fmt.Errorf("retry sleep failed: %w", sleepErr)
-			}
-		}
+// RetryWithPolicy executes body until it succeeds or policy gives up.
+// Errors the policy refuses to retry are returned unchanged; running out
+// of attempts or MaxElapsed returns a terminal error.
+func (wl *WorkflowLoop) RetryWithPolicy(body LoopBody, policy RetryPolicy) error {
+	attempts, exhausted, err := retryWithPolicy(wl.ctx, policy, "workflow.retry", func(attempt int) error {
+		wl.log.Info("workflow: retry attempt", "attempt", attempt+1, "max", policy.MaxAttempts)
+		return body(attempt)
+	})
+	if err == nil {
+		wl.log.Info("workflow: retry succeeded", "attempts", attempts)
+		return nil
+	}
+	if !exhausted {
+		return err
 	}
-
 	return restate.TerminalError(
-		fmt.Errorf("retry exhausted after %d attempts: %w", maxAttempts, lastErr),
+		fmt.Errorf("retry exhausted after %d attempts: %w", attempts, err),
 		500,
 	)
 }
@@ -693,656 +1101,6938 @@ func ForEach[T any](
 	body func(item T, index int) error,
 ) error {
 	ctx.Log().Info("workflow: foreach starting", "count", len(items))
+	tracker := progressFor(ctx)
 	for i, item := range items {
 		if err := body(item, i); err != nil {
 			return fmt.Errorf("foreach failed at index %d: %w", i, err)
 		}
+		tracker.Iteration("foreach", i, len(items))
 	}
 	ctx.Log().Info("workflow: foreach completed", "count", len(items))
 	return nil
 }
 
 // -----------------------------------------------------------------------------
-// Section 3: Type-Safe Durable State Management
+// Section 2B: Code Versioning
 // -----------------------------------------------------------------------------
 
-// State provides type-safe access to Restate's key-value store with runtime guards
-type State[T any] struct {
-	key string
-	ctx interface{} // Validated at runtime for write operations
+// WorkflowVersionsServiceName is the service name WorkflowVersions is bound
+// under by restate.Reflect.
+const WorkflowVersionsServiceName = "WorkflowVersions"
+
+const (
+	versionStatePrefix = "framework.version:"
+	versionChangesKey  = "framework.versions"
+)
+
+var (
+	versionReportService   string
+	versionReportServiceMu sync.RWMutex
+)
+
+// ReportVersionsTo makes Version and ReleaseVersions report to the
+// WorkflowVersions object bound under serviceName, usually
+// WorkflowVersionsServiceName. Reporting is off until this is called;
+// an empty name turns it off again.
+func ReportVersionsTo(serviceName string) {
+	versionReportServiceMu.Lock()
+	defer versionReportServiceMu.Unlock()
+	versionReportService = serviceName
 }
 
-// NewState creates a state accessor. Write operations require exclusive context.
-func NewState[T any](ctx interface{}, key string) *State[T] {
-	return &State[T]{ctx: ctx, key: key}
+func versionReporting() string {
+	versionReportServiceMu.RLock()
+	defer versionReportServiceMu.RUnlock()
+	return versionReportService
 }
 
-// Get retrieves state value. Safe from any context type.
-func (s *State[T]) Get() (T, error) {
-	var zero T
+// Version returns the code version an instance runs for changeID, so a
+// handler can change its sequence of durable calls without breaking replay
+// for instances already in flight:
+//
+//	v, err := framework.Version(ctx, "split-shipping", 1, 2)
+//	if err != nil {
+//	    return err
+//	}
+//	if v == 1 {
+//	    // old sequence, kept until no instance runs it
+//	} else {
+//	    // new sequence
+//	}
+//
+// The first evaluation journals maxVersion; replays return the journaled
+// value. In a workflow the version is also kept in state, so the shared
+// handlers of the same run see it. Virtual Objects and services version
+// each invocation on its own: an entity outlives any code version, and
+// only the journal of an invocation pins the branch it took. An instance
+// outside [minVersion, maxVersion] fails with a terminal 409: the branch
+// it needs was removed, or the code was rolled back below it.
+//
+// Version itself adds commands to the journal, so it must be in the
+// handler before an instance starts: adding the first Version call to a
+// handler breaks replay of invocations already in flight, like any other
+// new durable call. Put a Version call in place with a single version
+// ahead of the first change that needs it.
+//
+// With ReportVersionsTo, new versions are reported to WorkflowVersions,
+// which raises the "version_branch_unreachable" guardrail once no running
+// instance can take a branch below maxVersion any more. Call
+// ReleaseVersions when an instance finishes so it stops counting as
+// running.
+func Version(ctx restate.Context, changeID string, minVersion, maxVersion int) (int, error) {
+	if changeID == "" || minVersion > maxVersion {
+		return 0, restate.TerminalError(
+			fmt.Errorf("version: change id required and min %d must not exceed max %d", minVersion, maxVersion), 400)
+	}
+
+	kv, _ := ctx.(restate.WorkflowContext)
+	var recorded *int
+	var changes []string
+	if kv != nil {
+		v, err := restate.Get[*int](kv, versionStatePrefix+changeID)
+		if err != nil {
+			return 0, err
+		}
+		recorded = v
+		if recorded == nil {
+			if changes, err = restate.Get[[]string](kv, versionChangesKey); err != nil {
+				return 0, err
+			}
+		}
+	}
 
-	switch c := s.ctx.(type) {
-	case restate.ObjectContext:
-		return restate.Get[T](c, s.key)
-	case restate.ObjectSharedContext:
-		return restate.Get[T](c, s.key)
-	case restate.WorkflowContext:
-		return restate.Get[T](c, s.key)
-	case restate.WorkflowSharedContext:
-		return restate.Get[T](c, s.key)
-	//case restate.Context:
-	//return restate.Get[T](c, s.key)
-	default:
-		return zero, restate.TerminalError(fmt.Errorf("invalid context type for state get: %T", s.ctx), 400)
+	var version int
+	if recorded != nil {
+		version = *recorded
+	} else {
+		v, err := RunDo(ctx, func(rc restate.RunContext) (int, error) {
+			return maxVersion, nil
+		}, restate.WithName("version:"+changeID))
+		if err != nil {
+			return 0, err
+		}
+		version = v
 	}
-}
 
-// Set writes state value. Only permitted from exclusive contexts (enforced).
-func (s *State[T]) Set(value T) error {
-	switch c := s.ctx.(type) {
-	case restate.ObjectContext:
-		restate.Set(c, s.key, value)
-		return nil
-	case restate.WorkflowContext:
-		restate.Set(c, s.key, value)
-		return nil
-	default:
-		return restate.TerminalError(fmt.Errorf("Set called from read-only context: %T", s.ctx), 400)
+	if recorded == nil {
+		if kv != nil {
+			restate.Set(kv, versionStatePrefix+changeID, version)
+			restate.Set(kv, versionChangesKey, append(changes, changeID))
+		}
+		if service := versionReporting(); service != "" {
+			ObjectClient[VersionRecord, restate.Void]{
+				ServiceName: service,
+				HandlerName: "Record",
+			}.Send(ctx, changeID, VersionRecord{
+				Instance:   instanceKey(ctx),
+				Version:    version,
+				MinVersion: minVersion,
+				MaxVersion: maxVersion,
+			})
+		}
+		ctx.Log().Info("version.recorded", "change_id", changeID, "version", version)
+	}
+
+	if version < minVersion || version > maxVersion {
+		return 0, restate.TerminalError(fmt.Errorf("instance runs version %d of change %s, code supports %d-%d",
+			version, changeID, minVersion, maxVersion), 409)
 	}
+	return version, nil
 }
 
-// Clear removes state key. Only permitted from exclusive contexts.
-func (s *State[T]) Clear() error {
-	switch c := s.ctx.(type) {
-	case restate.ObjectContext:
-		restate.Clear(c, s.key)
-		return nil
-	case restate.WorkflowContext:
-		restate.Clear(c, s.key)
+// ReleaseVersions reports that this instance no longer runs the given
+// changes. In a workflow the changes default to every one Version recorded
+// for the run; Virtual Objects and services must name them. Call it as the
+// last step of a workflow, or at the end of a versioned invocation.
+func ReleaseVersions(ctx restate.Context, changeIDs ...string) error {
+	kv, _ := ctx.(restate.WorkflowContext)
+	if len(changeIDs) == 0 && kv != nil {
+		changes, err := restate.Get[[]string](kv, versionChangesKey)
+		if err != nil {
+			return err
+		}
+		changeIDs = changes
+	}
+
+	service := versionReporting()
+	if service == "" {
 		return nil
-	default:
-		return restate.TerminalError(fmt.Errorf("Clear called from read-only context: %T", s.ctx), 400)
 	}
+	instance := instanceKey(ctx)
+	for _, changeID := range changeIDs {
+		ObjectClient[string, restate.Void]{
+			ServiceName: service,
+			HandlerName: "Release",
+		}.Send(ctx, changeID, instance)
+	}
+	return nil
 }
 
-// ClearAll removes all state. Only permitted from exclusive contexts.
-func ClearAll(ctx interface{}) error {
-	switch c := ctx.(type) {
-	case restate.ObjectContext:
-		restate.ClearAll(c)
-		return nil
-	case restate.WorkflowContext:
-		restate.ClearAll(c)
-		return nil
-	default:
-		return restate.TerminalError(fmt.Errorf("ClearAll called from read-only context: %T", ctx), 400)
+// instanceKey identifies the calling instance: the key for workflows, the
+// invocation for Virtual Objects and services.
+func instanceKey(ctx restate.Context) string {
+	if kv, ok := ctx.(restate.WorkflowSharedContext); ok {
+		return "key:" + restate.Key(kv)
 	}
+	return "invocation:" + hex.EncodeToString(ctx.Request().ID)
 }
 
-// -----------------------------------------------------------------------------
-// Section 4: Durable Saga Framework - Distributed Transaction Compensation
-// -----------------------------------------------------------------------------
+// VersionRecord reports the version an instance took for a change, along
+// with the range the reporting code supports.
+type VersionRecord struct {
+	Instance   string `json:"instance"`
+	Version    int    `json:"version"`
+	MinVersion int    `json:"min_version"`
+	MaxVersion int    `json:"max_version"`
+}
 
-// SagaCompensationFunc executes a compensation action inside restate.Run.
-type SagaCompensationFunc func(rc restate.RunContext, payload []byte) error
+// VersionReport summarises a change across running instances.
+type VersionReport struct {
+	ChangeID   string      `json:"change_id"`
+	MinVersion int         `json:"min_version"`
+	MaxVersion int         `json:"max_version"`
+	Running    map[int]int `json:"running"` // version -> running instances
 
-// SagaEntry is the persisted record of a compensation step.
-type SagaEntry struct {
-	Name      string    `json:"name"`
-	Payload   []byte    `json:"payload"`
-	StepID    string    `json:"step_id"`
-	Timestamp time.Time `json:"timestamp"`
-	Attempt   int       `json:"attempt"`
+	// Unreachable lists versions the code still branches on that no running
+	// instance can take; raise minVersion past them and delete their branches
+	Unreachable []int `json:"unreachable,omitempty"`
 }
 
-// SagaConfig controls retry behavior and DLQ handling.
-type SagaConfig struct {
-	MaxRetries         int
-	InitialRetryDelay  time.Duration
-	MaxRetryDelay      time.Duration
-	FailOnCleanupError bool
-	DLQKey             string
-}
+// WorkflowVersions is a Virtual Object, keyed by change ID, counting the
+// running instances on each version of a change. It is opt-in: bind it and
+// enable reporting at startup.
+//
+//	server.Bind(restate.Reflect(framework.WorkflowVersions{}))
+//	framework.ReportVersionsTo(framework.WorkflowVersionsServiceName)
+type WorkflowVersions struct{}
 
-// DefaultSagaConfig returns production-ready retry defaults.
-func DefaultSagaConfig() SagaConfig {
-	return SagaConfig{
-		MaxRetries:         5,
-		InitialRetryDelay:  1 * time.Second,
-		MaxRetryDelay:      5 * time.Minute,
-		FailOnCleanupError: false,
-		DLQKey:             "",
+const (
+	versionInstancesKey = "instances"
+	versionRangeKey     = "range"
+)
+
+// Record adds a running instance and re-checks reachability.
+func (WorkflowVersions) Record(ctx restate.ObjectContext, rec VersionRecord) (restate.Void, error) {
+	instances, err := restate.Get[map[string]int](ctx, versionInstancesKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	if instances == nil {
+		instances = make(map[string]int)
 	}
+	instances[rec.Instance] = rec.Version
+	restate.Set(ctx, versionInstancesKey, instances)
+	restate.Set(ctx, versionRangeKey, [2]int{rec.MinVersion, rec.MaxVersion})
+	return restate.Void{}, checkVersionReachability(ctx)
 }
 
-// SagaFramework manages durable compensation for control plane operations.
-type SagaFramework struct {
-	wctx     restate.WorkflowContext
-	nsKey    string
-	dlqKey   string
-	registry map[string]SagaCompensationFunc
-	log      *slog.Logger
-	cfg      SagaConfig
+// Release removes a finished instance and re-checks reachability.
+func (WorkflowVersions) Release(ctx restate.ObjectContext, instance string) (restate.Void, error) {
+	instances, err := restate.Get[map[string]int](ctx, versionInstancesKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	if _, ok := instances[instance]; !ok {
+		return restate.Void{}, nil
+	}
+	delete(instances, instance)
+	restate.Set(ctx, versionInstancesKey, instances)
+	return restate.Void{}, checkVersionReachability(ctx)
 }
 
-// NewSaga creates a saga bound to a workflow context.
-func NewSaga(ctx restate.WorkflowContext, name string, cfg *SagaConfig) *SagaFramework {
-	instance := restate.Key(ctx)
-	ns := path.Join(instance, "saga", name)
-	dlq := path.Join(instance, "saga-dlq", name)
+// Report returns the running instances per version and any unreachable branches.
+func (WorkflowVersions) Report(ctx restate.ObjectSharedContext) (VersionReport, error) {
+	return versionReport(ctx)
+}
 
-	if cfg == nil {
-		c := DefaultSagaConfig()
-		cfg = &c
+func versionReport(ctx restate.ObjectSharedContext) (VersionReport, error) {
+	instances, err := restate.Get[map[string]int](ctx, versionInstancesKey)
+	if err != nil {
+		return VersionReport{}, err
 	}
-
-	if cfg.DLQKey != "" {
-		dlq = cfg.DLQKey
+	bounds, err := restate.Get[[2]int](ctx, versionRangeKey)
+	if err != nil {
+		return VersionReport{}, err
 	}
+	return newVersionReport(restate.Key(ctx), bounds, instances), nil
+}
 
-	return &SagaFramework{
-		wctx:     ctx,
-		nsKey:    ns,
-		dlqKey:   dlq,
-		registry: make(map[string]SagaCompensationFunc),
-		log:      ctx.Log(),
-		cfg:      *cfg,
+// newVersionReport counts instances, which map to their version, against
+// the [min, max] range the reporting code supports.
+func newVersionReport(changeID string, bounds [2]int, instances map[string]int) VersionReport {
+	report := VersionReport{
+		ChangeID:   changeID,
+		MinVersion: bounds[0],
+		MaxVersion: bounds[1],
+		Running:    make(map[int]int),
+	}
+	for _, v := range instances {
+		report.Running[v]++
+	}
+	// New instances always take MaxVersion, so only running ones keep older branches alive
+	for v := report.MinVersion; v < report.MaxVersion; v++ {
+		if report.Running[v] == 0 {
+			report.Unreachable = append(report.Unreachable, v)
+		}
 	}
+	return report
 }
 
-// Register adds a compensation handler. Must be called before Add.
-func (s *SagaFramework) Register(name string, fn SagaCompensationFunc) {
-	if fn == nil {
-		s.log.Warn("saga.register: nil handler ignored", "name", name)
-		return
+// checkVersionReachability raises the advisory "version_branch_unreachable"
+// guardrail when the code still carries branches nothing can take.
+func checkVersionReachability(ctx restate.ObjectContext) error {
+	report, err := versionReport(ctx)
+	if err != nil {
+		return err
 	}
-	s.registry[name] = fn
+	if len(report.Unreachable) == 0 {
+		return nil
+	}
+	_ = HandleGuardrailViolation(GuardrailViolation{
+		Check: "version_branch_unreachable",
+		Message: fmt.Sprintf("change %s: no running instance uses versions %v; raise minVersion and remove their branches",
+			report.ChangeID, report.Unreachable),
+		Severity: "warning",
+	}, ctx.Log(), PolicyWarn)
+	return nil
 }
 
-// ValidateCompensationIdempotent is a documentation/lint helper for compensation handlers.
-//
-// While the framework cannot enforce idempotency at runtime, this helper:
-//  1. Documents the idempotency contract clearly in code
-//  2. Provides a consistent API for developers
-//  3. Enables potential static analysis/linting
-//  4. Adds runtime logging to track compensation execution
-//
-// Compensation handlers MUST be idempotent because:
-//   - Restate may replay them during recovery
-//   - Retries will execute the same compensation multiple times
-//   - Network failures can cause duplicate attempts
-//
-// Usage:
+// -----------------------------------------------------------------------------
+// Section 2C: Signal Mailboxes
+// -----------------------------------------------------------------------------
+
+// Mailbox is a typed, durable, multi-message channel into a workflow.
+// Shared handlers Post messages; the run handler receives them in order.
+// Each message occupies its own durable promise, named by mailbox and
+// sequence number, so a mailbox accepts any number of messages where
+// GetInternalSignal accepts one.
 //
-//	saga.Register("charge_payment", ValidateCompensationIdempotent(
-//	    "charge_payment",
-//	    func(rc restate.RunContext, payload []byte) error {
-//	        var data PaymentData
-//	        json.Unmarshal(payload, &data)
-//	        // ✅ Idempotent: refund checks if already refunded
-//	        return refundPaymentIdempotent(data.PaymentID)
-//	    },
-//	))
+//	var revisions = framework.NewMailbox[Revision]("revisions")
 //
-// Idempotency Patterns:
-//  1. Check-Then-Act: Verify side effect not already done
-//  2. Use External Idempotency Keys: Payment provider handles deduplication
-//  3. State-Based Deduplication: Store completion flag in workflow state
-//  4. Set Absolute Values: Don't increment/decrement, set exact values
+//	func (DocWorkflow) Revise(ctx restate.WorkflowSharedContext, r Revision) error {
+//	    _, err := revisions.Post(ctx, r)
+//	    return err
+//	}
 //
-// Anti-Patterns to Avoid:
+//	func (DocWorkflow) Run(ctx restate.WorkflowContext, doc Doc) error {
+//	    for {
+//	        rev, ok, err := revisions.Receive(ctx, 24*time.Hour)
+//	        if err != nil || !ok {
+//	            return err
+//	        }
+//	        ...
+//	    }
+//	}
 //
-//	❌ Incrementing/decrementing without checks
-//	❌ Creating resources without unique constraints
-//	❌ Time-dependent logic (non-deterministic)
-//	❌ Assuming single execution
+// Delivered messages stay in workflow state until the workflow's retention
+// expires, so a mailbox suits hundreds of messages, not unbounded streams.
 //
-// See SAGA_GUIDE.MD for detailed patterns and examples.
-func ValidateCompensationIdempotent(
-	name string,
-	handler SagaCompensationFunc,
-) SagaCompensationFunc {
-	return func(rc restate.RunContext, payload []byte) error {
-		// Log compensation attempt for observability
-		// This helps track retries and identify non-idempotent handlers
-		// Future enhancement: Could add deduplication checks here
+// Capacity: shared handlers cannot write state, so Post finds a free slot by
+// peeking each slot from the receiver's cursor forward, one journaled Peek
+// per unread message. A post therefore costs O(backlog), and once
+// mailboxMaxProbe (1000) messages are unread Post fails with a terminal 429.
+// Retrying the same invocation would replay the same journaled peeks, so
+// callers post again in a new invocation once the run handler catches up.
+type Mailbox[T any] struct {
+	name string
+}
 
-		err := handler(rc, payload)
+// NewMailbox declares a mailbox. Declare it once at package level and use
+// it from both the shared handlers and the run handler.
+func NewMailbox[T any](name string) Mailbox[T] {
+	return Mailbox[T]{name: name}
+}
 
-		// Future: Could add runtime validations:
-		// - Track compensation IDs to detect duplicates
-		// - Validate payload schema
-		// - Check for state consistency
-		// - Monitor for suspicious retry patterns
+// mailboxEnvelope wraps messages so a resolved promise can be told apart
+// from an empty one even when the message is a zero value.
+type mailboxEnvelope[T any] struct {
+	Seq  int  `json:"seq"`
+	Sent bool `json:"sent"`
+	Msg  T    `json:"msg"`
+}
 
-		return err
-	}
+// mailboxMaxProbe bounds how many occupied slots Post skips before giving
+// up, which is the number of unread messages a mailbox holds.
+const mailboxMaxProbe = 1000
+
+func (mb Mailbox[T]) promiseName(seq int) string {
+	return fmt.Sprintf("mailbox:%s:%d", mb.name, seq)
 }
 
-// Add persists a compensation step BEFORE executing the main action.
-func (s *SagaFramework) Add(name string, payload any, dedupe bool) error {
-	raw, err := canonicalJSON(payload)
+func (mb Mailbox[T]) cursorKey() string {
+	return "mailbox:" + mb.name + ":next"
+}
+
+// Post enqueues a message and returns its sequence number. Concurrent posts
+// receive distinct sequence numbers.
+func (mb Mailbox[T]) Post(ctx restate.WorkflowSharedContext, msg T) (int, error) {
+	// The receiver's cursor is a lower bound for the first free slot
+	seq, err := restate.Get[int](ctx, mb.cursorKey())
 	if err != nil {
-		return fmt.Errorf("saga: marshal payload: %w", err)
+		return 0, err
 	}
 
-	stepID := deterministicStepID(name, raw)
+	for probes := 0; probes < mailboxMaxProbe; probes++ {
+		promise := restate.Promise[mailboxEnvelope[T]](ctx, mb.promiseName(seq))
+		current, err := promise.Peek()
+		if err != nil {
+			return 0, err
+		}
+		if current.Sent {
+			seq++
+			continue
+		}
 
-	// Read-modify-write with deduplication
-	entries, _ := restate.Get[[]SagaEntry](s.wctx, s.nsKey)
-	if dedupe {
-		for _, e := range entries {
-			if e.StepID == stepID {
-				s.log.Debug("saga.add: duplicate step ignored", "name", name, "step_id", stepID)
-				return nil
+		if err := promise.Resolve(mailboxEnvelope[T]{Seq: seq, Sent: true, Msg: msg}); err != nil {
+			// Lost the slot to a concurrent Post
+			if current, peekErr := promise.Peek(); peekErr == nil && current.Sent {
+				seq++
+				continue
 			}
+			return 0, err
 		}
+		ctx.Log().Debug("mailbox.posted", "mailbox", mb.name, "seq", seq)
+		return seq, nil
 	}
-
-	entry := SagaEntry{
-		Name:      name,
-		Payload:   raw,
-		StepID:    stepID,
-		Timestamp: time.Now(),
-		Attempt:   0,
-	}
-
-	entries = append(entries, entry)
-	restate.Set(s.wctx, s.nsKey, entries)
-	s.log.Info("saga.step_added", "name", name, "step_id", stepID)
-	return nil
+	// Terminal: a retry would replay the peeks above and find the same slots
+	return 0, restate.TerminalError(
+		fmt.Errorf("mailbox %s: %d messages unread, post again later", mb.name, mailboxMaxProbe), 429)
 }
 
-// CompensateIfNeeded executes all compensations in reverse order if error occurred.
-func (s *SagaFramework) CompensateIfNeeded(errPtr *error) {
-	if errPtr == nil || *errPtr == nil {
-		return
+// Receive waits for the next message. With a positive timeout it returns
+// ok=false if no message arrived in time; otherwise it waits indefinitely.
+func (mb Mailbox[T]) Receive(ctx restate.WorkflowContext, timeout time.Duration) (msg T, ok bool, err error) {
+	next, err := mb.Next(ctx)
+	if err != nil {
+		return msg, false, err
 	}
-
-	origErr := *errPtr
-	entries, _ := restate.Get[[]SagaEntry](s.wctx, s.nsKey)
-	if len(entries) == 0 {
-		s.log.Info("saga.no_compensations")
-		return
+	if timeout > 0 {
+		idx, err := Select(ctx, next, TimerCase(ctx, timeout))
+		if err != nil {
+			return msg, false, err
+		}
+		if idx == 1 {
+			ctx.Log().Info("mailbox.receive_timeout", "mailbox", mb.name, "seq", next.seq, "timeout", timeout.String())
+			return msg, false, nil
+		}
 	}
+	msg, err = next.Take(ctx)
+	if err != nil {
+		return msg, false, err
+	}
+	return msg, true, nil
+}
 
-	s.log.Info("saga.compensation.starting", "count", len(entries), "original_error", origErr.Error())
-
-	// Execute compensations in LIFO order
-	for idx := len(entries) - 1; idx >= 0; idx-- {
-		entry := entries[idx]
+// Next returns a receipt for the next message without consuming it, for use
+// with Select. Only the receipt that is taken advances the mailbox.
+func (mb Mailbox[T]) Next(ctx restate.WorkflowContext) (*MailboxReceipt[T], error) {
+	seq, err := restate.Get[int](ctx, mb.cursorKey())
+	if err != nil {
+		return nil, err
+	}
+	return &MailboxReceipt[T]{
+		mailbox: mb,
+		seq:     seq,
+		promise: restate.Promise[mailboxEnvelope[T]](ctx, mb.promiseName(seq)),
+	}, nil
+}
 
-		handler, ok := s.registry[entry.Name]
-		if !ok {
-			msg := fmt.Sprintf("missing compensation handler: %s", entry.Name)
-			s.log.Error("saga.missing_handler", "name", entry.Name)
-			s.persistDLQ(origErr, fmt.Errorf(msg), entries, idx)
-			*errPtr = restate.TerminalError(fmt.Errorf("%s: original=%w", msg, origErr), 500)
-			return
-		}
+// MailboxReceipt is the pending next message of a mailbox.
+type MailboxReceipt[T any] struct {
+	mailbox Mailbox[T]
+	seq     int
+	promise restate.DurablePromise[mailboxEnvelope[T]]
+}
 
-		// Retry loop with exponential backoff
-		for {
-			ents, _ := restate.Get[[]SagaEntry](s.wctx, s.nsKey)
-			if idx >= len(ents) {
-				msg := fmt.Errorf("compensation index out of range: idx=%d len=%d", idx, len(ents))
-				s.log.Error("saga.index_oob", "idx", idx, "len", len(ents))
-				s.persistDLQ(origErr, msg, ents, idx)
-				*errPtr = restate.TerminalError(fmt.Errorf("compensation state corrupted: %w", origErr), 500)
-				return
-			}
+// Seq is the sequence number the receipt waits for.
+func (r *MailboxReceipt[T]) Seq() int {
+	return r.seq
+}
 
-			cur := ents[idx]
+// Take waits for the message, if it has not arrived yet, and advances the mailbox.
+func (r *MailboxReceipt[T]) Take(ctx restate.WorkflowContext) (T, error) {
+	var zero T
+	cursor, err := restate.Get[int](ctx, r.mailbox.cursorKey())
+	if err != nil {
+		return zero, err
+	}
+	if cursor != r.seq {
+		return zero, restate.TerminalError(fmt.Errorf("mailbox %s: receipt for message %d is stale, next is %d",
+			r.mailbox.name, r.seq, cursor), 500)
+	}
 
-			// Execute compensation using RunDoVoid to prevent outer context capture
-			runErr := RunDoVoid(s.wctx, func(rc restate.RunContext) error {
-				s.log.Info("saga.compensation.attempting", "name", cur.Name, "attempt", cur.Attempt+1)
-				return handler(rc, cur.Payload)
-			}, restate.WithName(fmt.Sprintf("saga.compensate.%s", cur.Name)))
+	env, err := r.promise.Result()
+	if err != nil {
+		return zero, err
+	}
+	restate.Set(ctx, r.mailbox.cursorKey(), r.seq+1)
+	return env.Msg, nil
+}
 
-			if runErr == nil {
-				// Success: remove this compensation from the list
-				ents = removeIndex(ents, idx)
-				restate.Set(s.wctx, s.nsKey, ents)
-				s.log.Info("saga.compensation.succeeded", "name", cur.Name)
-				break
-			}
+func (r *MailboxReceipt[T]) selectFuture() restate.Future {
+	return r.promise
+}
 
-			// Failure: increment attempt counter
-			cur.Attempt++
-			ents[idx] = cur
-			restate.Set(s.wctx, s.nsKey, ents)
-			s.log.Warn("saga.compensation.failed", "name", cur.Name, "attempt", cur.Attempt, "err", runErr.Error())
+// SelectCase is one branch of Select: a MailboxReceipt, TimerCase or FutureCase.
+type SelectCase interface {
+	selectFuture() restate.Future
+}
 
-			// Check if max retries exceeded
-			if s.cfg.MaxRetries >= 0 && cur.Attempt >= s.cfg.MaxRetries {
-				msg := fmt.Errorf("max retries exceeded for %s (attempts=%d): last_err=%w",
-					cur.Name, cur.Attempt, runErr)
-				s.log.Error("saga.compensation.max_retries", "name", cur.Name, "attempts", cur.Attempt)
-				s.persistDLQ(origErr, msg, ents, idx)
-				*errPtr = restate.TerminalError(fmt.Errorf("compensation failed irrecoverably: %w", origErr), 500)
-				return
-			}
+type futureCase struct {
+	fut restate.Future
+}
 
-			// Schedule exponential backoff
-			delay := computeBackoff(s.cfg.InitialRetryDelay, s.cfg.MaxRetryDelay, cur.Attempt-1)
-			s.log.Info("saga.compensation.retry_scheduled", "name", cur.Name, "delay", delay.String())
+func (c futureCase) selectFuture() restate.Future {
+	return c.fut
+}
 
-			if sleepErr := restate.Sleep(s.wctx, delay); sleepErr != nil {
-				s.log.Error("saga.sleep_failed", "err", sleepErr.Error())
-				s.persistDLQ(origErr, sleepErr, ents, idx)
-				*errPtr = restate.TerminalError(fmt.Errorf("saga sleep failed: %w", origErr), 500)
-				return
-			}
-		}
-	}
+// TimerCase is a Select branch that fires after d.
+func TimerCase(ctx restate.Context, d time.Duration) SelectCase {
+	return futureCase{fut: restate.After(ctx, d)}
+}
 
-	// All compensations succeeded
-	restate.Clear(s.wctx, s.nsKey)
-	s.log.Info("saga.compensation.completed")
+// FutureCase makes any Restate future a Select branch.
+func FutureCase(fut restate.Future) SelectCase {
+	return futureCase{fut: fut}
 }
 
-// persistDLQ records irrecoverable compensation failures to dead-letter queue.
-func (s *SagaFramework) persistDLQ(originalErr, escalationErr error, entries []SagaEntry, cursor int) {
-	_ = RunDoVoid(s.wctx, func(rc restate.RunContext) error {
-		record := map[string]any{
-			"saga_key":                     s.nsKey,
-			"original_error":               originalErr.Error(),
-			"escalation_error":             escalationErr.Error(),
-			"entries":                      entries,
-			"cursor":                       cursor,
-			"timestamp":                    time.Now(),
-			"hostname":                     os.Getenv("HOSTNAME"),
-			"requires_manual_intervention": true,
-		}
-		jsonBytes, err := json.Marshal(record)
-		if err != nil {
-			return err
-		}
-		restate.Set(s.wctx, s.dlqKey, jsonBytes)
-		s.log.Error("saga.dlq_recorded", "dlq_key", s.dlqKey)
-		return nil
-	}, restate.WithName("saga.persist_dlq"))
+// Select waits until one of the cases is ready and returns its index. A
+// mailbox branch must still be taken with MailboxReceipt.Take; the others
+// stay unconsumed.
+//
+//	rev, _ := revisions.Next(ctx)
+//	pay, _ := payments.Next(ctx)
+//	switch idx, err := framework.Select(ctx, rev, pay, framework.TimerCase(ctx, time.Hour)); {
+//	case err != nil:
+//	    return err
+//	case idx == 0:
+//	    r, err := rev.Take(ctx)
+//	    ...
+//	}
+func Select(ctx restate.Context, cases ...SelectCase) (int, error) {
+	futures := make([]restate.Future, len(cases))
+	for i, c := range cases {
+		futures[i] = c.selectFuture()
+	}
+	result, err := Race(ctx, futures...)
+	if err != nil {
+		return -1, err
+	}
+	return result.Index, nil
 }
 
 // -----------------------------------------------------------------------------
-// Section 5: Control Plane Service
+// Section 2D: Continue-As-New
 // -----------------------------------------------------------------------------
 
-// ControlPlaneService provides orchestration capabilities with built-in saga management.
-type ControlPlaneService struct {
-	name              string
-	saga              *SagaFramework
-	idempotencyPrefix string
+// ContinueAsNewPolicy decides when a long-running loop hands its state over
+// to a fresh instance. Every journal entry of an invocation is replayed on
+// recovery, so a polling or subscription loop that never hands over slows
+// down until it hits the journal size limit.
+type ContinueAsNewPolicy struct {
+	// MaxIterations continues after this many iterations in one instance
+	MaxIterations int
+
+	// MaxJournalEntries continues once the estimated journal length reaches
+	// it. The estimate is EntriesPerIteration per iteration, the status
+	// writes of a ProgressTracker, and whatever the body reports through
+	// ContinuableLoop.Journal.
+	MaxJournalEntries int
+
+	// EntriesPerIteration is the estimated number of journal entries the
+	// body adds per iteration, e.g. a Sleep, a Run and a call make 3
+	// (default 4)
+	EntriesPerIteration int
+}
+
+// defaultEntriesPerIteration assumes a typical polling body: a timer, a
+// side effect, a call and a state write.
+const defaultEntriesPerIteration = 4
+
+// DefaultContinueAsNewPolicy hands over every 1000 iterations, well below
+// the 10000 iteration safety limit of WorkflowLoop.
+func DefaultContinueAsNewPolicy() ContinueAsNewPolicy {
+	return ContinueAsNewPolicy{MaxIterations: 1000, EntriesPerIteration: defaultEntriesPerIteration}
+}
+
+// Continuation is the input of every generation of a continuable loop. The
+// first generation is started with only State set.
+type Continuation[S any] struct {
+	State S `json:"state"`
+
+	// Generation counts handovers; the first instance is generation 0
+	Generation int `json:"generation"`
+
+	// Iteration is the number of iterations completed by earlier generations
+	Iteration int `json:"iteration"`
+
+	// Origin is the workflow ID or object key of generation 0
+	Origin string `json:"origin,omitempty"`
+
+	// Previous is the workflow ID or object key of the generation that
+	// handed over to this one
+	Previous string `json:"previous,omitempty"`
+}
+
+// ContinuationLink points from a finished generation to its successor.
+type ContinuationLink struct {
+	Kind        ScheduleTargetKind `json:"kind"`
+	ServiceName string             `json:"serviceName"`
+	HandlerName string             `json:"handlerName"`
+	Key         string             `json:"key"`
+	Generation  int                `json:"generation"`
+	Iteration   int                `json:"iteration"`
+}
+
+// LoopResult is what a generation of a continuable loop completes with:
+// the final state when the loop finished, or the link to the generation
+// that carries on.
+type LoopResult[S any] struct {
+	State       S                 `json:"state"`
+	Completed   bool              `json:"completed"`
+	ContinuedAs *ContinuationLink `json:"continuedAs,omitempty"`
+}
+
+// ContinuedAsStateKey holds the ContinuationLink of the latest handover on
+// a Virtual Object key. Generations share the key, so the link is not
+// cleared when the successor starts: it names the generation currently
+// running (or the last one, once the loop completed) and is overwritten by
+// the next handover. Workflow generations run under their own IDs and
+// return the link as their result instead.
+const ContinuedAsStateKey = "framework.continued_as"
+
+// ContinuableLoop runs a loop across as many instances as it needs. After
+// the policy's iteration or journal budget, it starts the next generation
+// with the loop state and completes the current one with a link to it.
+//
+// In a Workflow, generation N runs under the ID "<origin>.gen<N>", since
+// a workflow ID runs once. In a Virtual Object the next generation is a
+// fresh invocation of the same handler on the same key.
+//
+//	func (Poller) Run(ctx restate.WorkflowContext, in framework.Continuation[Cursor]) (framework.LoopResult[Cursor], error) {
+//	    loop := framework.NewContinuableLoop(ctx, in, framework.ScheduleTargetWorkflow, "Poller", "Run", framework.DefaultContinueAsNewPolicy())
+//	    return loop.Run(func(cur Cursor, iteration int) (Cursor, bool, error) {
+//	        if err := restate.Sleep(ctx, time.Minute); err != nil {
+//	            return cur, false, err
+//	        }
+//	        ...
+//	        return next, false, nil
+//	    })
+//	}
+type ContinuableLoop[S any] struct {
+	ctx         restate.Context
+	in          Continuation[S]
+	kind        ScheduleTargetKind
+	serviceName string
+	handlerName string
+	policy      ContinueAsNewPolicy
+	journal     int
 }
 
-// NewControlPlaneService creates an orchestrator with automatic saga setup.
-func NewControlPlaneService(ctx restate.WorkflowContext, name string, idempotencyPrefix string) *ControlPlaneService {
-	return &ControlPlaneService{
-		name:              name,
-		saga:              NewSaga(ctx, name, nil),
-		idempotencyPrefix: idempotencyPrefix,
+// NewContinuableLoop prepares a loop for the handler serviceName/handlerName
+// that ctx belongs to. kind is ScheduleTargetWorkflow for a workflow run
+// handler, with ctx a WorkflowContext, or ScheduleTargetObject for an
+// exclusive object handler, with ctx an ObjectContext.
+func NewContinuableLoop[S any](
+	ctx restate.Context,
+	in Continuation[S],
+	kind ScheduleTargetKind,
+	serviceName, handlerName string,
+	policy ContinueAsNewPolicy,
+) *ContinuableLoop[S] {
+	if policy.MaxIterations <= 0 && policy.MaxJournalEntries <= 0 {
+		policy.MaxIterations = DefaultContinueAsNewPolicy().MaxIterations
+	}
+	if policy.EntriesPerIteration <= 0 {
+		policy.EntriesPerIteration = defaultEntriesPerIteration
+	}
+	return &ContinuableLoop[S]{
+		ctx:         ctx,
+		in:          in,
+		kind:        kind,
+		serviceName: serviceName,
+		handlerName: handlerName,
+		policy:      policy,
 	}
 }
 
-// Orchestrate executes a function within a saga context with automatic compensation.
-func (cp *ControlPlaneService) Orchestrate(fn func() error) (err error) {
-	defer cp.saga.CompensateIfNeeded(&err)
-	return fn()
-}
-
-// RegisterCompensation adds a compensation handler to the saga.
-func (cp *ControlPlaneService) RegisterCompensation(name string, fn SagaCompensationFunc) {
-	cp.saga.Register(name, fn)
+// Generation returns the generation this instance runs.
+func (l *ContinuableLoop[S]) Generation() int {
+	return l.in.Generation
 }
 
-// AddCompensationStep persists a compensation step before executing main action.
-func (cp *ControlPlaneService) AddCompensationStep(name string, payload any, dedupe bool) error {
-	return cp.saga.Add(name, payload, dedupe)
+// Journal adds n entries to the journal estimate, for iterations whose
+// size varies, e.g. one that fans out to a call per item.
+func (l *ContinuableLoop[S]) Journal(n int) {
+	l.journal += n
 }
 
-// AwaitHumanApproval coordinates human-in-the-loop with durable timeout.
-func (cp *ControlPlaneService) AwaitHumanApproval(
-	ctx restate.Context,
-	approvalID string,
-	timeout time.Duration,
-) (approved bool, err error) {
-	awakeable := WaitForExternalSignal[bool](ctx)
-	awakeableID := awakeable.Id()
-
-	ctx.Log().Info("controlplane.awaiting_approval", "approval_id", approvalID, "awakeable_id", awakeableID)
-
-	// Race against timeout
-	timeoutFuture := restate.After(ctx, timeout)
-	winner, err := restate.WaitFirst(ctx, awakeable, timeoutFuture)
+// Run calls body with the loop state and the overall iteration number
+// until body reports done or the policy hands over. A body error fails
+// the current generation without handing over.
+func (l *ContinuableLoop[S]) Run(body func(state S, iteration int) (S, bool, error)) (LoopResult[S], error) {
+	self, err := l.instance()
 	if err != nil {
-		return false, fmt.Errorf("approval race failed: %w", err)
+		return LoopResult[S]{State: l.in.State}, err
+	}
+	origin := l.in.Origin
+	if origin == "" {
+		origin = self
 	}
 
-	// Check if timeout occurred - AfterFuture completes with nil error on timeout
-	if winner == timeoutFuture {
+	state := l.in.State
+	tracker := progressFor(l.ctx)
+	tracker.Annotate("generation", l.in.Generation)
+	for local := 0; ; local++ {
+		if l.due(local) {
+			link, err := l.handOver(origin, self, state, l.in.Iteration+local)
+			if err != nil {
+				return LoopResult[S]{State: state}, err
+			}
+			return LoopResult[S]{State: state, ContinuedAs: &link}, nil
+		}
+
+		iteration := l.in.Iteration + local
+		next, done, err := body(state, iteration)
+		if err != nil {
+			return LoopResult[S]{State: state}, fmt.Errorf("loop body failed at iteration %d: %w", iteration, err)
+		}
+		state = next
+		l.journal += l.policy.EntriesPerIteration
+		if tracker.Iteration("loop", iteration, 0) {
+			l.journal += progressWriteEntries
+		}
+		if done {
+			l.ctx.Log().Info("workflow: continuable loop completed",
+				"generation", l.in.Generation, "iterations", iteration+1)
+			return LoopResult[S]{State: state, Completed: true}, nil
+		}
+	}
+}
+
+// due reports whether the policy's budget for this instance is spent.
+func (l *ContinuableLoop[S]) due(local int) bool {
+	if l.policy.MaxIterations > 0 && local >= l.policy.MaxIterations {
+		return true
+	}
+	return l.policy.MaxJournalEntries > 0 && l.journal >= l.policy.MaxJournalEntries
+}
+
+// instance returns the workflow ID or object key of the running instance,
+// checking that ctx matches the loop's kind.
+func (l *ContinuableLoop[S]) instance() (string, error) {
+	switch l.kind {
+	case ScheduleTargetWorkflow:
+		if ctx, ok := l.ctx.(restate.WorkflowContext); ok {
+			return restate.Key(ctx), nil
+		}
+	case ScheduleTargetObject:
+		if ctx, ok := l.ctx.(restate.ObjectContext); ok {
+			return restate.Key(ctx), nil
+		}
+	default:
+		return "", restate.TerminalError(fmt.Errorf("continue-as-new does not support %q handlers", l.kind), 500)
+	}
+	return "", restate.TerminalError(fmt.Errorf("continue-as-new: context does not belong to a %s handler", l.kind), 500)
+}
+
+// handOver starts the next generation and, on an object, records the link
+// in state.
+func (l *ContinuableLoop[S]) handOver(origin, self string, state S, iteration int) (ContinuationLink, error) {
+	next := Continuation[S]{
+		State:      state,
+		Generation: l.in.Generation + 1,
+		Iteration:  iteration,
+		Origin:     origin,
+		Previous:   self,
+	}
+	link := ContinuationLink{
+		Kind:        l.kind,
+		ServiceName: l.serviceName,
+		HandlerName: l.handlerName,
+		Generation:  next.Generation,
+		Iteration:   iteration,
+	}
+
+	if l.kind == ScheduleTargetWorkflow {
+		link.Key = fmt.Sprintf("%s.gen%d", origin, next.Generation)
+		restate.WorkflowSend(l.ctx, l.serviceName, link.Key, l.handlerName).Send(next)
+	} else {
+		link.Key = self
+		idem := fmt.Sprintf("continue-as-new/%s/%s/%d", l.serviceName, origin, next.Generation)
+		restate.ObjectSend(l.ctx, l.serviceName, self, l.handlerName).Send(next, restate.WithIdempotencyKey(idem))
+		restate.Set(l.ctx.(restate.ObjectContext), ContinuedAsStateKey, link)
+	}
+
+	progressFor(l.ctx).Annotate("continued_as", link.Key)
+	l.ctx.Log().Info("workflow: continued as new",
+		"generation", next.Generation,
+		"iterations", iteration,
+		"next", link.Key,
+		"journal_estimate", l.journal)
+	return link, nil
+}
+
+// -----------------------------------------------------------------------------
+// Section 3: Type-Safe Durable State Management
+// -----------------------------------------------------------------------------
+
+// State provides type-safe access to Restate's key-value store with runtime guards
+type State[T any] struct {
+	key string
+	ctx interface{} // Validated at runtime for write operations
+}
+
+// NewState creates a state accessor. Write operations require exclusive context.
+func NewState[T any](ctx interface{}, key string) *State[T] {
+	return &State[T]{ctx: ctx, key: key}
+}
+
+// Get retrieves state value. Safe from any context type.
+func (s *State[T]) Get() (T, error) {
+	var zero T
+
+	switch c := s.ctx.(type) {
+	case restate.ObjectContext:
+		return restate.Get[T](c, s.key)
+	case restate.ObjectSharedContext:
+		return restate.Get[T](c, s.key)
+	case restate.WorkflowContext:
+		return restate.Get[T](c, s.key)
+	case restate.WorkflowSharedContext:
+		return restate.Get[T](c, s.key)
+	//case restate.Context:
+	//return restate.Get[T](c, s.key)
+	default:
+		return zero, restate.TerminalError(fmt.Errorf("invalid context type for state get: %T", s.ctx), 400)
+	}
+}
+
+// Set writes state value. Only permitted from exclusive contexts (enforced).
+func (s *State[T]) Set(value T) error {
+	switch c := s.ctx.(type) {
+	case restate.ObjectContext:
+		restate.Set(c, s.key, value)
+		return nil
+	case restate.WorkflowContext:
+		restate.Set(c, s.key, value)
+		return nil
+	default:
+		return restate.TerminalError(fmt.Errorf("Set called from read-only context: %T", s.ctx), 400)
+	}
+}
+
+// Clear removes state key. Only permitted from exclusive contexts.
+func (s *State[T]) Clear() error {
+	switch c := s.ctx.(type) {
+	case restate.ObjectContext:
+		restate.Clear(c, s.key)
+		return nil
+	case restate.WorkflowContext:
+		restate.Clear(c, s.key)
+		return nil
+	default:
+		return restate.TerminalError(fmt.Errorf("Clear called from read-only context: %T", s.ctx), 400)
+	}
+}
+
+// ClearAll removes all state. Only permitted from exclusive contexts.
+func ClearAll(ctx interface{}) error {
+	switch c := ctx.(type) {
+	case restate.ObjectContext:
+		restate.ClearAll(c)
+		return nil
+	case restate.WorkflowContext:
+		restate.ClearAll(c)
+		return nil
+	default:
+		return restate.TerminalError(fmt.Errorf("ClearAll called from read-only context: %T", ctx), 400)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Section 4: Durable Saga Framework - Distributed Transaction Compensation
+// -----------------------------------------------------------------------------
+
+// SagaCompensationFunc executes a compensation action inside restate.Run.
+type SagaCompensationFunc func(rc restate.RunContext, payload []byte) error
+
+// SagaEntry is the persisted record of a compensation step.
+type SagaEntry struct {
+	Name      string         `json:"name"`
+	Payload   []byte         `json:"payload"`
+	StepID    string         `json:"step_id"`
+	Timestamp time.Time      `json:"timestamp"`
+	Attempt   int            `json:"attempt"`
+	DependsOn []string       `json:"depends_on,omitempty"`
+	Group     string         `json:"group,omitempty"`
+	Status    SagaStepStatus `json:"status,omitempty"`
+
+	// SchemaVersion is the payload schema the step was added with; upcasters
+	// migrate it to the handler's current version before compensation.
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	// Locks lists the SagaLock resource keys held on behalf of this step
+	Locks []string `json:"locks,omitempty"`
+
+	// Timeout bounds each remote compensation attempt; zero uses the saga
+	// default
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// ReattachAttempt is the attempt whose remote call timed out but may
+	// still be running. Later attempts reuse its idempotency key, attaching
+	// to that call instead of starting a second undo, until an attempt
+	// completes with a failure.
+	ReattachAttempt int `json:"reattach_attempt,omitempty"`
+}
+
+// SagaStepStatus tracks whether a step's forward action actually finished.
+type SagaStepStatus string
+
+const (
+	// SagaStepPending means the step was added but its action has not reported an outcome
+	SagaStepPending SagaStepStatus = "pending"
+
+	// SagaStepCompleted means the action succeeded and its effects must be undone on rollback
+	SagaStepCompleted SagaStepStatus = "completed"
+
+	// SagaStepFailed means the action failed without effects, so there is nothing to compensate
+	SagaStepFailed SagaStepStatus = "failed"
+)
+
+// effectiveStatus returns the entry's lifecycle status. Entries persisted
+// before status tracking existed are treated as completed, matching how
+// they were compensated previously.
+func (e SagaEntry) effectiveStatus() SagaStepStatus {
+	if e.Status == "" {
+		return SagaStepCompleted
+	}
+	return e.Status
+}
+
+// needsCompensation reports whether the entry must be undone under strategy.
+// Failed steps never are; pending steps are skipped by CompensateCompleted.
+func (e SagaEntry) needsCompensation(strategy CompensationStrategy) bool {
+	switch e.effectiveStatus() {
+	case SagaStepFailed:
+		return false
+	case SagaStepPending:
+		return strategy != CompensateCompleted
+	default:
+		return true
+	}
+}
+
+// SagaStepOption declares how a step relates to earlier steps in the
+// compensation graph. A step added without options depends on the step
+// added immediately before it, which preserves strict LIFO rollback.
+type SagaStepOption struct {
+	// DependsOn names earlier steps this step builds on. Their compensations
+	// only run after this step has been compensated. Overrides Group ordering.
+	// Naming a step that has not been added fails Add.
+	DependsOn []string
+
+	// Group marks consecutive steps as independent siblings. Members of the
+	// same group are compensated concurrently once every later step is undone.
+	Group string
+
+	// Locks are resource keys acquired through SagaLock before the step is
+	// persisted. They are held until the saga completes or is compensated.
+	Locks []string
+
+	// Timeout bounds each remote compensation attempt of this step,
+	// overriding SagaConfig.CompensationTimeout. Local compensations are
+	// never timed out.
+	Timeout time.Duration
+}
+
+// SagaConfig controls retry behavior and DLQ handling.
+type SagaConfig struct {
+	MaxRetries         int
+	InitialRetryDelay  time.Duration
+	MaxRetryDelay      time.Duration
+	FailOnCleanupError bool
+	DLQKey             string
+
+	// RetryPolicy replaces MaxRetries and the retry delays when set. It also
+	// drives forward recovery, whose attempts stay bounded by
+	// ForwardMaxRetries. A remote compensation handler retries its own
+	// non-terminal failures inside the callee, so only its terminal errors
+	// and timeouts reach the policy; a RetryOn that accepts terminal errors
+	// keeps those retried.
+	RetryPolicy *RetryPolicy
+
+	// DLQService is the SagaDLQ Virtual Object that receives failure records,
+	// keyed by saga name. Empty (the default) keeps records in workflow or
+	// object state only; set it to SagaDLQServiceName once SagaDLQ is bound.
+	// Service sagas have no durable state, so NewServiceSaga raises the
+	// "saga_service_without_dlq" guardrail when it is empty.
+	DLQService string
+
+	// RecoveryMode selects backward (compensate) or forward (re-drive) recovery
+	RecoveryMode SagaRecoveryMode
+
+	// ForwardMaxRetries bounds the attempts at re-driving one step before it
+	// escalates, mapped like MaxRetries: zero allows a single attempt and a
+	// negative value retries without limit. An operator resume grants
+	// another round of the same size.
+	ForwardMaxRetries int
+
+	// ForwardFallback decides what happens when forward progress is impossible
+	ForwardFallback SagaForwardFallback
+
+	// HumanTimeout bounds the wait for an operator under ForwardFallbackHuman.
+	// Expiry falls back to compensation.
+	HumanTimeout time.Duration
+
+	// OnForwardEscalation notifies operators; it runs inside restate.Run
+	OnForwardEscalation func(rc restate.RunContext, esc SagaForwardEscalation) error
+
+	// TimelineLimit caps the persisted timeline; the oldest events are
+	// dropped first. Zero keeps every event.
+	TimelineLimit int
+
+	// Escalation pauses for an operator when a compensation exhausts
+	// MaxRetries. Nil writes to the DLQ and fails the saga immediately.
+	Escalation *SagaEscalationPolicy
+
+	// LockService is the SagaLock Virtual Object used for SagaStepOption.Locks
+	LockService string
+
+	// LockLease bounds how long a lock survives without being released, so a
+	// crashed or stuck saga cannot hold a resource forever. Sagas that may
+	// outlive it must call RenewLocks; an expired lease is reported through
+	// the "saga_lock_expired" guardrail.
+	LockLease time.Duration
+
+	// CompensationTimeout bounds each remote compensation attempt. A
+	// timed-out attempt counts as failed and is retried with backoff, and
+	// the retry attaches to the abandoned call through its idempotency key.
+	// Local compensations run in restate.Run, which cannot be abandoned
+	// without a second copy running next to it, so they are never timed
+	// out. Zero waits indefinitely.
+	CompensationTimeout time.Duration
+
+	// RollbackDeadline bounds the whole rollback. Breaching it escalates
+	// through Escalation (retry extends the deadline, skip disarms it) or,
+	// without a policy, writes to the DLQ. Zero disables the deadline.
+	RollbackDeadline time.Duration
+}
+
+// SagaEscalationDecision is an operator's answer to a compensation escalation.
+type SagaEscalationDecision string
+
+const (
+	// SagaDecisionRetry grants the step another MaxRetries attempts
+	SagaDecisionRetry SagaEscalationDecision = "retry"
+
+	// SagaDecisionSkip treats the step as compensated and moves on
+	SagaDecisionSkip SagaEscalationDecision = "skip"
+
+	// SagaDecisionAbort writes to the DLQ and fails the saga
+	SagaDecisionAbort SagaEscalationDecision = "abort"
+)
+
+// SagaEscalationPolicy configures human escalation of exhausted compensations.
+type SagaEscalationPolicy struct {
+	// UsePromise waits on a durable promise instead of an awakeable, so the
+	// decision can be delivered with ResolveSagaEscalation from a shared
+	// workflow handler. Ignored outside workflows.
+	UsePromise bool
+
+	// Timeout bounds the wait; TimeoutDecision applies on expiry (default abort)
+	Timeout         time.Duration
+	TimeoutDecision SagaEscalationDecision
+
+	// Notify tells operators where to send the decision; it runs inside restate.Run
+	Notify func(rc restate.RunContext, esc SagaCompensationEscalation) error
+}
+
+// SagaCompensationEscalation describes a compensation waiting on an operator.
+// Resolve AwakeableID, or PromiseName via ResolveSagaEscalation, with one
+// of the SagaEscalationDecision values.
+type SagaCompensationEscalation struct {
+	SagaName    string `json:"saga_name"`
+	SagaKey     string `json:"saga_key"`
+	Step        string `json:"step"`
+	StepID      string `json:"step_id"`
+	Attempt     int    `json:"attempt"`
+	Error       string `json:"error"`
+	AwakeableID string `json:"awakeable_id,omitempty"`
+	PromiseName string `json:"promise_name,omitempty"`
+}
+
+// ResolveSagaEscalation delivers a decision to a saga waiting on a durable
+// promise. Call it from a shared handler of the workflow running the saga.
+func ResolveSagaEscalation(ctx restate.WorkflowSharedContext, promiseName string, decision SagaEscalationDecision) error {
+	switch decision {
+	case SagaDecisionRetry, SagaDecisionSkip, SagaDecisionAbort:
+	default:
+		return restate.TerminalError(fmt.Errorf("unknown escalation decision %q", decision), 400)
+	}
+	return restate.Promise[SagaEscalationDecision](ctx, promiseName).Resolve(decision)
+}
+
+// SagaRecoveryMode selects how a failed saga is resolved.
+type SagaRecoveryMode string
+
+const (
+	// SagaRecoveryBackward compensates steps in reverse order (default)
+	SagaRecoveryBackward SagaRecoveryMode = "backward"
+
+	// SagaRecoveryForward re-drives unfinished steps until the process completes
+	SagaRecoveryForward SagaRecoveryMode = "forward"
+)
+
+// SagaForwardFallback is applied when a step can no longer be pushed forward:
+// its action returned a terminal error, has no forward handler, or exhausted
+// ForwardMaxRetries.
+type SagaForwardFallback string
+
+const (
+	// ForwardFallbackCompensate rolls the saga back as in backward mode
+	ForwardFallbackCompensate SagaForwardFallback = "compensate"
+
+	// ForwardFallbackHuman waits on an awakeable for an operator decision
+	ForwardFallbackHuman SagaForwardFallback = "human"
+)
+
+// SagaForwardEscalation describes a step that forward recovery gave up on.
+// Resolve AwakeableID with true to keep re-driving, or false to compensate.
+type SagaForwardEscalation struct {
+	SagaName    string `json:"saga_name"`
+	SagaKey     string `json:"saga_key"`
+	Step        string `json:"step"`
+	StepID      string `json:"step_id"`
+	Attempt     int    `json:"attempt"`
+	Error       string `json:"error"`
+	AwakeableID string `json:"awakeable_id,omitempty"`
+}
+
+// SagaForwardFunc re-executes a step's forward action inside restate.Run.
+// Like compensations, forward actions must be idempotent.
+type SagaForwardFunc func(rc restate.RunContext, payload []byte) error
+
+// DefaultSagaConfig returns production-ready retry defaults.
+func DefaultSagaConfig() SagaConfig {
+	return SagaConfig{
+		MaxRetries:         5,
+		InitialRetryDelay:  1 * time.Second,
+		MaxRetryDelay:      5 * time.Minute,
+		FailOnCleanupError: false,
+		DLQKey:             "",
+		DLQService:         "",
+		RecoveryMode:       SagaRecoveryBackward,
+		ForwardMaxRetries:  10,
+		ForwardFallback:    ForwardFallbackCompensate,
+		HumanTimeout:       24 * time.Hour,
+		TimelineLimit:      500,
+		LockService:        SagaLockServiceName,
+		LockLease:          1 * time.Hour,
+	}
+}
+
+// compensationPolicy is the retry schedule of compensations. Without a
+// RetryPolicy every failure is retried, terminal ones included, until
+// MaxRetries escalates it.
+func (c SagaConfig) compensationPolicy() RetryPolicy {
+	if c.RetryPolicy != nil {
+		return *c.RetryPolicy
+	}
+	return RetryPolicy{
+		MaxAttempts:  attemptsFromRetries(c.MaxRetries),
+		InitialDelay: c.InitialRetryDelay,
+		MaxDelay:     c.MaxRetryDelay,
+		RetryOn:      func(error) bool { return true },
+	}
+}
+
+// forwardPolicy is the retry schedule of forward recovery; attempts are
+// always bounded by ForwardMaxRetries.
+func (c SagaConfig) forwardPolicy() RetryPolicy {
+	p := RetryPolicy{InitialDelay: c.InitialRetryDelay, MaxDelay: c.MaxRetryDelay}
+	if c.RetryPolicy != nil {
+		p = *c.RetryPolicy
+	}
+	p.MaxAttempts = attemptsFromRetries(c.ForwardMaxRetries)
+	return p
+}
+
+// SagaFramework manages durable compensation for control plane operations.
+type SagaFramework struct {
+	ctx        restate.Context
+	state      sagaState
+	key        string
+	name       string
+	nsKey      string
+	dlqKey     string
+	registry   map[string]SagaCompensationFunc
+	remotes    map[string]SagaHandlerRef
+	forward    map[string]SagaForwardFunc
+	schemas    map[string]*sagaSchema
+	aliases    map[string]string
+	deprecated map[string]string
+	log        *slog.Logger
+	cfg        SagaConfig
+
+	// scoped sagas live for one invocation and drop their state once resolved
+	scoped   bool
+	released bool
+
+	// parent is set on sub-sagas created by Child
+	parent      *SagaFramework
+	scope       string
+	timelineKey string
+
+	// lockOwner identifies the root saga to SagaLock, so locks taken by a
+	// child stay valid after its entries are folded into the parent
+	lockOwner string
+
+	// strategy is the strategy of the running compensation, recorded in
+	// DLQ records so an operator retry skips the same steps
+	strategy CompensationStrategy
+
+	// clock is the last journaled timestamp. While batchTimeline is set,
+	// record buffers events in pendingEvents and flushTimeline writes them
+	// once per wave, stamping events without a time with clock.
+	clock         time.Time
+	batchTimeline bool
+	pendingEvents []SagaTimelineEvent
+}
+
+// NewSaga creates a saga bound to a workflow context.
+func NewSaga(ctx restate.WorkflowContext, name string, cfg *SagaConfig) *SagaFramework {
+	instance := restate.Key(ctx)
+	return newSaga(ctx, kvSagaState{ctx: ctx}, instance, path.Join(instance, "saga", name),
+		path.Join(instance, "saga-dlq", name), name, cfg)
+}
+
+// NewObjectSaga creates a saga inside a Virtual Object handler. State is
+// namespaced by object key and invocation ID, so concurrent invocations on
+// the same key never see each other's steps, and it is cleared once
+// CompensateIfNeeded or RecoverIfNeeded resolves the saga. Failures that
+// reach the DLQ keep their entries in the SagaDLQ record.
+//
+//	func (UserSession) Checkout(ctx restate.ObjectContext, req CheckoutRequest) (err error) {
+//	    saga := framework.NewObjectSaga(ctx, "checkout", nil)
+//	    defer saga.CompensateIfNeeded(&err)
+//	    ...
+//	}
+func NewObjectSaga(ctx restate.ObjectContext, name string, cfg *SagaConfig) *SagaFramework {
+	instance := restate.Key(ctx)
+	invocation := hex.EncodeToString(ctx.Request().ID)
+	s := newSaga(ctx, kvSagaState{ctx: ctx}, instance, path.Join(instance, "saga", name, invocation),
+		path.Join(instance, "saga-dlq", name), name, cfg)
+	s.scoped = true
+	return s
+}
+
+// NewServiceSaga creates a saga for a stateless service handler. Entries are
+// kept in memory and rebuilt on replay, since every Add re-executes
+// deterministically; compensations themselves are journaled via restate.Run.
+//
+// A DLQ record kept in memory is lost when the invocation ends, so set
+// SagaConfig.DLQService to a bound SagaDLQ; without it the saga logs the
+// "saga_service_without_dlq" guardrail.
+func NewServiceSaga(ctx restate.Context, name string, cfg *SagaConfig) *SagaFramework {
+	invocation := hex.EncodeToString(ctx.Request().ID)
+	s := newSaga(ctx, &memorySagaState{values: make(map[string][]byte)}, invocation,
+		path.Join(invocation, "saga", name), path.Join(invocation, "saga-dlq", name), name, cfg)
+	s.scoped = true
+	if s.cfg.DLQService == "" {
+		// The constructor cannot fail, so the violation is advisory
+		_ = HandleGuardrailViolation(GuardrailViolation{
+			Check:    "saga_service_without_dlq",
+			Message:  fmt.Sprintf("service saga %q has no DLQService; its DLQ records are lost when the invocation ends", name),
+			Severity: "warning",
+		}, s.log, PolicyWarn)
+	}
+	return s
+}
+
+func newSaga(ctx restate.Context, state sagaState, key, ns, dlq, name string, cfg *SagaConfig) *SagaFramework {
+	if cfg == nil {
+		c := DefaultSagaConfig()
+		cfg = &c
+	}
+
+	if cfg.DLQKey != "" {
+		dlq = cfg.DLQKey
+	}
+
+	return &SagaFramework{
+		ctx:        ctx,
+		state:      state,
+		key:        key,
+		name:       name,
+		nsKey:      ns,
+		dlqKey:     dlq,
+		registry:   make(map[string]SagaCompensationFunc),
+		remotes:    make(map[string]SagaHandlerRef),
+		forward:    make(map[string]SagaForwardFunc),
+		schemas:    make(map[string]*sagaSchema),
+		aliases:    make(map[string]string),
+		deprecated: make(map[string]string),
+		log:        ctx.Log(),
+		cfg:        *cfg,
+
+		timelineKey: sagaTimelineKey(ns),
+		lockOwner:   ns,
+	}
+}
+
+// Child creates a sub-saga whose steps are kept apart from the parent's.
+// Resolve it with CompensateIfNeeded or RecoverIfNeeded like any saga: a
+// failure compensates only the child's steps, and the caller decides
+// whether to recover locally or return the error to the parent. On success
+// the child's entries are folded into the parent, so a later parent failure
+// still undoes them.
+//
+//	booking := saga.Child("booking")
+//	err := func() (err error) {
+//	    defer booking.CompensateIfNeeded(&err)
+//	    return bookFlightAndHotel(ctx, booking)
+//	}()
+//	if err != nil {
+//	    // booking is already rolled back; try another provider or return err
+//	}
+//
+// Children share the parent's handler registry, configuration and
+// timeline, so handlers may be registered on either.
+func (s *SagaFramework) Child(name string) *SagaFramework {
+	scope := name
+	if s.scope != "" {
+		scope = path.Join(s.scope, name)
+	}
+	return &SagaFramework{
+		ctx:         s.ctx,
+		state:       s.state,
+		key:         s.key,
+		name:        s.name,
+		nsKey:       path.Join(s.nsKey, "child", name),
+		dlqKey:      s.dlqKey,
+		registry:    s.registry,
+		remotes:     s.remotes,
+		forward:     s.forward,
+		aliases:     s.aliases,
+		deprecated:  s.deprecated,
+		schemas:     s.schemas,
+		log:         s.log.With("saga_scope", scope),
+		cfg:         s.cfg,
+		scoped:      s.scoped,
+		parent:      s,
+		scope:       scope,
+		timelineKey: s.timelineKey,
+		lockOwner:   s.lockOwner,
+	}
+}
+
+// settle resolves a saga that finished without error: children fold into
+// their parent, while a root saga releases every lock its steps hold.
+func (s *SagaFramework) settle() {
+	if s.parent != nil {
+		s.fold()
+		return
+	}
+	if s.released {
+		return
+	}
+	entries, _ := getSagaState[[]SagaEntry](s.state, s.nsKey)
+	s.releaseLocks(entries)
+}
+
+// fold hands a successful child's entries to its parent.
+func (s *SagaFramework) fold() {
+	if s.parent == nil || s.released {
+		return
+	}
+	entries, _ := getSagaState[[]SagaEntry](s.state, s.nsKey)
+	if len(entries) == 0 {
+		return
+	}
+
+	parentEntries, _ := getSagaState[[]SagaEntry](s.state, s.parent.nsKey)
+	parentEntries = append(parentEntries, entries...)
+	s.state.set(s.parent.nsKey, parentEntries)
+	s.record(SagaTimelineEvent{Kind: SagaEventChildFolded, At: s.lastNow(), Note: fmt.Sprintf("%d steps", len(entries))})
+	s.log.Info("saga.child.folded", "count", len(entries))
+}
+
+// release drops a scoped saga's state once it has been resolved. Child
+// state is always released: its entries now live in the parent or the DLQ.
+func (s *SagaFramework) release() {
+	if (!s.scoped && s.parent == nil) || s.released {
+		return
+	}
+	s.released = true
+	s.state.clear(s.nsKey)
+	s.state.clear(fmt.Sprintf("%s:strategy", s.nsKey))
+	if s.parent == nil {
+		s.state.clear(s.timelineKey)
+	}
+}
+
+// sagaState is where a saga keeps its entries: Restate K/V state for
+// workflows and objects, or invocation memory for plain services.
+type sagaState interface {
+	get(key string, v any) error
+	set(key string, v any)
+	clear(key string)
+}
+
+// getSagaState reads key, returning the zero value when it is unset.
+func getSagaState[T any](st sagaState, key string) (T, error) {
+	var v T
+	err := st.get(key, &v)
+	return v, err
+}
+
+// kvSagaState stores saga state in the Restate K/V store.
+type kvSagaState struct {
+	ctx restate.ObjectContext
+}
+
+func (st kvSagaState) get(key string, v any) error {
+	raw, err := restate.Get[json.RawMessage](st.ctx, key)
+	if err != nil || len(raw) == 0 {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (st kvSagaState) set(key string, v any) {
+	restate.Set(st.ctx, key, v)
+}
+
+func (st kvSagaState) clear(key string) {
+	restate.Clear(st.ctx, key)
+}
+
+// memorySagaState keeps saga state for the lifetime of one invocation.
+// Values round-trip through JSON so reads never alias earlier writes.
+type memorySagaState struct {
+	values map[string][]byte
+}
+
+func (st *memorySagaState) get(key string, v any) error {
+	raw, ok := st.values[key]
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (st *memorySagaState) set(key string, v any) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	st.values[key] = raw
+}
+
+func (st *memorySagaState) clear(key string) {
+	delete(st.values, key)
+}
+
+// Register adds a compensation handler. Must be called before Add.
+func (s *SagaFramework) Register(name string, fn SagaCompensationFunc) {
+	if fn == nil {
+		s.log.Warn("saga.register: nil handler ignored", "name", name)
+		return
+	}
+	s.registry[name] = fn
+}
+
+// RegisterForward adds the forward action used to re-drive a step in
+// SagaRecoveryForward mode. Steps without one cannot be pushed forward.
+func (s *SagaFramework) RegisterForward(name string, fn SagaForwardFunc) {
+	if fn == nil {
+		s.log.Warn("saga.register_forward: nil handler ignored", "name", name)
+		return
+	}
+	s.forward[name] = fn
+}
+
+// SagaHandlerRef names a handler, owned by another service, that undoes a
+// step. The saga calls it durably with the step's JSON payload and an
+// idempotency key of the saga, SagaEntry.StepID and the attempt, so each
+// domain service can own its rollback logic. The key changes only after a
+// call completed with a failure; see sagaIdempotencyKey. The handler's
+// response is ignored.
+type SagaHandlerRef struct {
+	ServiceName string
+	HandlerName string
+
+	// Key selects the Virtual Object instance from the payload; leave it
+	// nil to call a plain service
+	Key func(payload []byte) (string, error)
+}
+
+// RegisterRemote compensates name by calling ref instead of a local closure.
+//
+//	saga.RegisterRemote("release_inventory", framework.SagaHandlerRef{
+//	    ServiceName: "Inventory",
+//	    HandlerName: "Release",
+//	})
+func (s *SagaFramework) RegisterRemote(name string, ref SagaHandlerRef) {
+	if ref.ServiceName == "" || ref.HandlerName == "" {
+		s.log.Warn("saga.register_remote: incomplete handler reference ignored", "name", name)
+		return
+	}
+	s.remotes[name] = ref
+}
+
+// RegisterServiceCompensation compensates name by calling a service handler
+// that accepts the step's payload type.
+func RegisterServiceCompensation[P, O any](s *SagaFramework, name string, client ServiceClient[P, O]) {
+	s.RegisterRemote(name, SagaHandlerRef{ServiceName: client.ServiceName, HandlerName: client.HandlerName})
+}
+
+// RegisterObjectCompensation compensates name by calling a Virtual Object
+// handler; key picks the object instance from the typed payload.
+//
+//	framework.RegisterObjectCompensation(saga, "refund_payment",
+//	    framework.ObjectClient[Refund, restate.Void]{ServiceName: "Account", HandlerName: "Refund"},
+//	    func(r Refund) string { return r.AccountID })
+func RegisterObjectCompensation[P, O any](s *SagaFramework, name string, client ObjectClient[P, O], key func(P) string) {
+	s.RegisterRemote(name, SagaHandlerRef{
+		ServiceName: client.ServiceName,
+		HandlerName: client.HandlerName,
+		Key:         typedSagaKey(key),
+	})
+}
+
+// undo resolves a step's compensation: local closures first, then remote
+// handlers, then the process-wide registries populated by
+// RegisterSagaCompensation and RegisterRemoteSagaCompensation.
+func (s *SagaFramework) undo(name string) (sagaUndo, bool) {
+	name = s.resolve(name)
+	if fn, ok := s.registry[name]; ok {
+		return sagaUndo{local: fn}, true
+	}
+	if ref, ok := s.remotes[name]; ok {
+		return sagaUndo{remote: &ref}, true
+	}
+	return lookupSagaUndo(s.name, name)
+}
+
+// sagaUndo is a resolved compensation: a local closure or a remote handler.
+type sagaUndo struct {
+	local  SagaCompensationFunc
+	remote *SagaHandlerRef
+}
+
+// start begins compensating entry and returns the future to wait on plus a
+// function reporting its outcome once the future completes. A local
+// compensation's failure is journaled as an attempt outcome classified by
+// policy, so it is counted instead of being retried inside the Run.
+func (u sagaUndo) start(ctx restate.Context, entry SagaEntry, payload []byte, idempotencyKey, runName string, policy RetryPolicy) (restate.Future, func() error, error) {
+	if u.remote == nil {
+		fut, outcome := startAttempt(ctx, policy, entry.Attempt+1, func(rc restate.RunContext) (restate.Void, error) {
+			return restate.Void{}, u.local(rc, payload)
+		}, restate.WithName(runName))
+		return fut, func() error {
+			_, err := outcome()
+			return err
+		}, nil
+	}
+
+	opt := restate.WithIdempotencyKey(idempotencyKey)
+	var fut restate.ResponseFuture[restate.Void]
+	if u.remote.Key == nil {
+		fut = restate.Service[restate.Void](ctx, u.remote.ServiceName, u.remote.HandlerName).
+			RequestFuture(json.RawMessage(payload), opt)
+	} else {
+		key, err := u.remote.Key(payload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("saga: resolve object key for %s: %w", entry.Name, err)
+		}
+		fut = restate.Object[restate.Void](ctx, u.remote.ServiceName, key, u.remote.HandlerName).
+			RequestFuture(json.RawMessage(payload), opt)
+	}
+	return fut, func() error {
+		_, err := fut.Response()
+		return err
+	}, nil
+}
+
+// run compensates entry and waits for the outcome. A remote compensation
+// fails the attempt if timeout elapses first.
+func (u sagaUndo) run(ctx restate.Context, entry SagaEntry, payload []byte, idempotencyKey, runName string, policy RetryPolicy, timeout time.Duration) error {
+	fut, result, err := u.start(ctx, entry, payload, idempotencyKey, runName, policy)
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 || u.remote == nil {
+		return result()
+	}
+
+	timer := restate.After(ctx, timeout)
+	winner, err := restate.WaitFirst(ctx, fut, timer)
+	if err != nil {
+		return err
+	}
+	if winner == timer {
+		return fmt.Errorf("compensation %s timed out after %s", entry.Name, timeout)
+	}
+	return result()
+}
+
+// sagaIdempotencyKey identifies one remote compensation call of a step. The
+// saga namespace keeps identical payloads in different sagas apart.
+//
+// The key is not StepID alone: Restate answers a repeated idempotency key
+// with the stored result of the first call, failures included, so a step
+// whose undo failed could never be retried. The attempt number starts a
+// new call only after the previous one completed with a failure; a
+// timed-out attempt's key is reused (see ReattachAttempt), so concurrent
+// undos of the same step never run.
+func sagaIdempotencyKey(nsKey string, entry SagaEntry) string {
+	attempt := entry.Attempt + 1
+	if entry.ReattachAttempt > 0 {
+		attempt = entry.ReattachAttempt
+	}
+	return fmt.Sprintf("%s/%s/%d", nsKey, entry.StepID, attempt)
+}
+
+// typedSagaKey adapts a typed key selector to raw payloads.
+func typedSagaKey[P any](key func(P) string) func([]byte) (string, error) {
+	if key == nil {
+		return nil
+	}
+	return func(raw []byte) (string, error) {
+		var payload P
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return "", err
+		}
+		return key(payload), nil
+	}
+}
+
+// uniqueStepID suffixes id until no entry uses it, so repeated steps added
+// without dedupe get distinct idempotency keys.
+func uniqueStepID(entries []SagaEntry, id string) string {
+	candidate := id
+	for n := 2; ; n++ {
+		taken := false
+		for _, e := range entries {
+			if e.StepID == candidate {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", id, n)
+	}
+}
+
+// SagaUpcaster migrates a persisted payload from one schema version to the next.
+type SagaUpcaster func(payload []byte) ([]byte, error)
+
+// sagaSchema is a step's current payload version and its upcasters,
+// keyed by the version they migrate from. payloadType is the P of a typed
+// registration, nil for raw handlers.
+type sagaSchema struct {
+	version     int
+	payloadType reflect.Type
+	upcasters   map[int]SagaUpcaster
+}
+
+// RegisterTyped adds a compensation handler that receives its payload decoded
+// into P. version is the current payload schema (starting at 1); entries added
+// with an older version are migrated through RegisterUpcaster first.
+//
+//	framework.RegisterTyped(saga, "refund_payment", 2,
+//	    func(rc restate.RunContext, p RefundV2) error {
+//	        return payments.Refund(p.ChargeID, p.Amount)
+//	    })
+//	saga.RegisterUpcaster("refund_payment", 1, refundV1ToV2)
+func RegisterTyped[P any](s *SagaFramework, name string, version int, fn func(rc restate.RunContext, payload P) error) {
+	if fn == nil {
+		s.log.Warn("saga.register_typed: nil handler ignored", "name", name)
+		return
+	}
+	sc := s.schemaFor(name)
+	sc.version = version
+	sc.payloadType = reflect.TypeFor[P]()
+	s.Register(name, typedCompensation(name, fn))
+}
+
+// AddTyped persists a compensation step whose payload type matches the
+// handler registered with RegisterTyped. The current schema version is
+// recorded on the entry. A step without a typed registration, or one
+// registered for another payload type, fails the Add instead of failing to
+// decode at compensation time.
+func AddTyped[P any](s *SagaFramework, name string, payload P, dedupe bool, opts ...SagaStepOption) error {
+	var message string
+	want := reflect.TypeFor[P]()
+	switch sc := s.schema(name); {
+	case sc == nil || sc.payloadType == nil:
+		message = fmt.Sprintf("saga step %q has no typed compensation; call RegisterTyped before AddTyped", name)
+	case sc.payloadType != want:
+		message = fmt.Sprintf("saga step %q is registered for payload %s, not %s", name, sc.payloadType, want)
+	}
+	if message != "" {
+		violation := GuardrailViolation{
+			Check:    "saga_typed_payload_mismatch",
+			Message:  message,
+			Severity: "error",
+		}
+		if err := HandleGuardrailViolation(violation, s.log, PolicyStrict); err != nil {
+			return err
+		}
+	}
+	return s.Add(name, payload, dedupe, opts...)
+}
+
+// RegisterUpcaster migrates payloads of step name from fromVersion to fromVersion+1.
+func (s *SagaFramework) RegisterUpcaster(name string, fromVersion int, fn SagaUpcaster) {
+	if fn == nil {
+		s.log.Warn("saga.register_upcaster: nil upcaster ignored", "name", name, "from", fromVersion)
+		return
+	}
+	s.schemaFor(name).upcasters[fromVersion] = fn
+}
+
+// schemaFor returns the local schema for name, creating it if needed.
+func (s *SagaFramework) schemaFor(name string) *sagaSchema {
+	sc, ok := s.schemas[name]
+	if !ok {
+		sc = &sagaSchema{upcasters: make(map[int]SagaUpcaster)}
+		s.schemas[name] = sc
+	}
+	return sc
+}
+
+// schema resolves a step's schema, falling back to the process-wide registry.
+func (s *SagaFramework) schema(name string) *sagaSchema {
+	if sc, ok := s.schemas[name]; ok {
+		return sc
+	}
+	return lookupSagaSchema(s.name, name)
+}
+
+// payload returns the entry's payload migrated to the current schema of
+// the handler that will compensate it.
+func (s *SagaFramework) payload(entry SagaEntry) ([]byte, error) {
+	return migrateSagaPayload(s.schema(s.resolve(entry.Name)), entry)
+}
+
+// Alias keeps entries persisted under oldName compensable after the handler
+// is renamed to newName. Register the new name as usual:
+//
+//	saga.Register("refund_payment_v2", refund)
+//	saga.Alias("refund_payment", "refund_payment_v2")
+func (s *SagaFramework) Alias(oldName, newName string) {
+	if oldName == "" || newName == "" || oldName == newName {
+		s.log.Warn("saga.alias: invalid alias ignored", "old", oldName, "new", newName)
+		return
+	}
+	s.aliases[oldName] = newName
+}
+
+// Deprecate marks a compensation name as scheduled for removal. Existing
+// entries still compensate, but adding new steps under it raises the
+// "saga_deprecated_compensation" guardrail as a warning.
+func (s *SagaFramework) Deprecate(name, reason string) {
+	s.deprecated[name] = reason
+}
+
+// resolve follows local aliases, then process-wide ones, to the current name.
+func (s *SagaFramework) resolve(name string) string {
+	for hops := 0; hops < maxSagaAliasHops; hops++ {
+		next, ok := s.aliases[name]
+		if !ok {
+			return resolveSagaAlias(s.name, name)
+		}
+		name = next
+	}
+	return name
+}
+
+// deprecation reports why name is deprecated, locally or process-wide.
+func (s *SagaFramework) deprecation(name string) (string, bool) {
+	if reason, ok := s.deprecated[name]; ok {
+		return reason, true
+	}
+	return lookupSagaDeprecation(s.name, name)
+}
+
+// typedCompensation decodes the payload into P before calling fn. Decode
+// failures are terminal because retrying cannot fix a schema mismatch.
+func typedCompensation[P any](name string, fn func(rc restate.RunContext, payload P) error) SagaCompensationFunc {
+	return func(rc restate.RunContext, raw []byte) error {
+		var payload P
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return restate.TerminalError(fmt.Errorf("saga: decode payload for %s: %w", name, err), 500)
+		}
+		return fn(rc, payload)
+	}
+}
+
+// migrateSagaPayload upcasts an entry's payload one version at a time.
+// Entries persisted before versioning are treated as version 1.
+func migrateSagaPayload(sc *sagaSchema, entry SagaEntry) ([]byte, error) {
+	if sc == nil || sc.version == 0 {
+		return entry.Payload, nil
+	}
+
+	from := entry.SchemaVersion
+	if from == 0 {
+		from = 1
+	}
+	if from > sc.version {
+		return nil, fmt.Errorf("saga: payload for %s has schema v%d, newer than handler v%d",
+			entry.Name, from, sc.version)
+	}
+
+	payload := entry.Payload
+	for v := from; v < sc.version; v++ {
+		up, ok := sc.upcasters[v]
+		if !ok {
+			return nil, fmt.Errorf("saga: no upcaster for %s from v%d to v%d", entry.Name, v, v+1)
+		}
+		migrated, err := up(payload)
+		if err != nil {
+			return nil, fmt.Errorf("saga: upcast %s from v%d: %w", entry.Name, v, err)
+		}
+		payload = migrated
+	}
+	return payload, nil
+}
+
+// ValidateCompensationIdempotent is a documentation/lint helper for compensation handlers.
+//
+// While the framework cannot enforce idempotency at runtime, this helper:
+//  1. Documents the idempotency contract clearly in code
+//  2. Provides a consistent API for developers
+//  3. Enables potential static analysis/linting
+//  4. Adds runtime logging to track compensation execution
+//
+// Compensation handlers MUST be idempotent because:
+//   - Restate may replay them during recovery
+//   - Retries will execute the same compensation multiple times
+//   - Network failures can cause duplicate attempts
+//
+// Usage:
+//
+//	saga.Register("charge_payment", ValidateCompensationIdempotent(
+//	    "charge_payment",
+//	    func(rc restate.RunContext, payload []byte) error {
+//	        var data PaymentData
+//	        json.Unmarshal(payload, &data)
+//	        // ✅ Idempotent: refund checks if already refunded
+//	        return refundPaymentIdempotent(data.PaymentID)
+//	    },
+//	))
+//
+// Idempotency Patterns:
+//  1. Check-Then-Act: Verify side effect not already done
+//  2. Use External Idempotency Keys: Payment provider handles deduplication
+//  3. State-Based Deduplication: Store completion flag in workflow state
+//  4. Set Absolute Values: Don't increment/decrement, set exact values
+//
+// Anti-Patterns to Avoid:
+//
+//	❌ Incrementing/decrementing without checks
+//	❌ Creating resources without unique constraints
+//	❌ Time-dependent logic (non-deterministic)
+//	❌ Assuming single execution
+//
+// See SAGA_GUIDE.MD for detailed patterns and examples.
+func ValidateCompensationIdempotent(
+	name string,
+	handler SagaCompensationFunc,
+) SagaCompensationFunc {
+	return func(rc restate.RunContext, payload []byte) error {
+		// Log compensation attempt for observability
+		// This helps track retries and identify non-idempotent handlers
+		// Future enhancement: Could add deduplication checks here
+
+		err := handler(rc, payload)
+
+		// Future: Could add runtime validations:
+		// - Track compensation IDs to detect duplicates
+		// - Validate payload schema
+		// - Check for state consistency
+		// - Monitor for suspicious retry patterns
+
+		return err
+	}
+}
+
+// Add persists a compensation step BEFORE executing the main action.
+//
+// Options declare dependencies or groups for the compensation graph:
+//
+//	saga.Add("release_inventory", inv, true, SagaStepOption{Group: "order"})
+//	saga.Add("refund_payment", pay, true, SagaStepOption{Group: "order"})
+//	saga.Add("cancel_shipment", ship, true, SagaStepOption{
+//	    DependsOn: []string{"release_inventory", "refund_payment"},
+//	})
+//
+// On failure cancel_shipment is undone first, then the two "order" siblings
+// are compensated concurrently.
+func (s *SagaFramework) Add(name string, payload any, dedupe bool, opts ...SagaStepOption) error {
+	raw, err := canonicalJSON(payload)
+	if err != nil {
+		return fmt.Errorf("saga: marshal payload: %w", err)
+	}
+
+	stepID := deterministicStepID(name, raw)
+	opt := mergeSagaStepOptions(opts)
+
+	// Read-modify-write with deduplication
+	entries, _ := getSagaState[[]SagaEntry](s.state, s.nsKey)
+	if dedupe {
+		for _, e := range entries {
+			if e.StepID == stepID {
+				s.log.Debug("saga.add: duplicate step ignored", "name", name, "step_id", stepID)
+				return nil
+			}
+		}
+	}
+
+	if reason, ok := s.deprecation(name); ok {
+		// Advisory only: deprecated handlers keep working until removed
+		_ = HandleGuardrailViolation(GuardrailViolation{
+			Check:    "saga_deprecated_compensation",
+			Message:  fmt.Sprintf("saga step %q uses a deprecated compensation: %s", name, reason),
+			Severity: "warning",
+		}, s.log, PolicyWarn)
+	}
+
+	// Repeated steps keep distinct IDs so their remote compensations are not
+	// deduplicated against each other
+	if !dedupe {
+		stepID = uniqueStepID(entries, stepID)
+	}
+
+	// Dependencies can only point backwards, which keeps the graph acyclic.
+	// An unknown name would drop the edge and reorder the rollback, so it
+	// fails whatever the global policy.
+	for _, dep := range opt.DependsOn {
+		if !hasSagaEntry(entries, dep) {
+			violation := GuardrailViolation{
+				Check:    "saga_unknown_dependency",
+				Message:  fmt.Sprintf("saga step %q depends on %q, which has not been added", name, dep),
+				Severity: "error",
+			}
+			if err := HandleGuardrailViolation(violation, s.log, PolicyStrict); err != nil {
+				return err
+			}
+		}
+	}
+
+	if undo, ok := s.undo(name); ok && undo.remote == nil && opt.Timeout > 0 {
+		_ = HandleGuardrailViolation(GuardrailViolation{
+			Check:    "saga_local_compensation_timeout",
+			Message:  fmt.Sprintf("saga step %q sets a Timeout, but its compensation is local and is never timed out", name),
+			Severity: "warning",
+		}, s.log, PolicyWarn)
+	}
+
+	// Locks are taken before the step exists, so a conflict fails the saga
+	// before it touches the resource. Locks taken for this step are given
+	// back on failure, since no entry will ever release them.
+	var taken []string
+	for _, resource := range opt.Locks {
+		if err := s.acquireLock(resource, name); err != nil {
+			s.releaseResources(entries, taken)
+			return err
+		}
+		taken = append(taken, resource)
+	}
+
+	entry := SagaEntry{
+		Name:      name,
+		Payload:   raw,
+		StepID:    stepID,
+		Timestamp: time.Now(),
+		Attempt:   0,
+		DependsOn: opt.DependsOn,
+		Group:     opt.Group,
+		Status:    SagaStepPending,
+		Locks:     opt.Locks,
+		Timeout:   opt.Timeout,
+	}
+	if sc := s.schema(name); sc != nil {
+		entry.SchemaVersion = sc.version
+	}
+
+	entries = append(entries, entry)
+	s.state.set(s.nsKey, entries)
+	s.record(SagaTimelineEvent{Kind: SagaEventStepAdded, Step: name, StepID: stepID, At: entry.Timestamp})
+	if !untrackedSagaSteps[name] {
+		progressFor(s.ctx).StepStarted(name, "")
+	}
+	s.log.Info("saga.step_added", "name", name, "step_id", stepID)
+	return nil
+}
+
+// untrackedSagaSteps are steps the framework adds for its own bookkeeping.
+// Reporting them would fill CompletedSteps and count against ExpectSteps.
+var untrackedSagaSteps = map[string]bool{childCancelStep: true}
+
+// MarkCompleted records that the forward action of the most recent pending
+// step with this name succeeded. Call it right after the action returns:
+//
+//	if err := saga.Add("refund_payment", payment, true); err != nil {
+//	    return err
+//	}
+//	if _, err := chargePayment(ctx, payment); err != nil {
+//	    return err
+//	}
+//	if err := saga.MarkCompleted("refund_payment"); err != nil {
+//	    return err
+//	}
+func (s *SagaFramework) MarkCompleted(name string) error {
+	return s.markStep(name, SagaStepCompleted, nil)
+}
+
+// MarkFailed records that the forward action of the most recent pending step
+// with this name failed without side effects, so it is never compensated.
+func (s *SagaFramework) MarkFailed(name string) error {
+	return s.markStep(name, SagaStepFailed, nil)
+}
+
+// markStep transitions the latest pending entry named name to status.
+func (s *SagaFramework) markStep(name string, status SagaStepStatus, payload []byte) error {
+	entries, _ := getSagaState[[]SagaEntry](s.state, s.nsKey)
+	for idx := len(entries) - 1; idx >= 0; idx-- {
+		if entries[idx].Name != name || entries[idx].Status != SagaStepPending {
+			continue
+		}
+		entries[idx].Status = status
+		if payload != nil {
+			entries[idx].Payload = payload
+		}
+		s.state.set(s.nsKey, entries)
+		switch tracker := progressFor(s.ctx); {
+		case untrackedSagaSteps[name]:
+		case status == SagaStepCompleted:
+			tracker.StepCompleted(name)
+		default:
+			tracker.StepFailed(name, nil)
+		}
+		s.log.Info("saga.step_marked", "name", name, "step_id", entries[idx].StepID, "status", status)
+		return nil
+	}
+
+	return HandleGuardrailViolation(GuardrailViolation{
+		Check:    "saga_mark_unknown_step",
+		Message:  fmt.Sprintf("no pending saga step named %q to mark %s", name, status),
+		Severity: "warning",
+	}, s.log, "")
+}
+
+// CompensateIfNeeded executes all compensations in reverse dependency order if error occurred.
+//
+// Steps whose dependents have all been compensated run concurrently via
+// restate.RunAsync. Steps added without SagaStepOption form a chain, so
+// plain sagas still roll back one step at a time in LIFO order. Failed
+// steps are skipped, as are pending steps under CompensateCompleted.
+func (s *SagaFramework) CompensateIfNeeded(errPtr *error) {
+	defer s.release()
+	if errPtr == nil || *errPtr == nil {
+		s.settle()
+		return
+	}
+
+	origErr := *errPtr
+	entries, _ := getSagaState[[]SagaEntry](s.state, s.nsKey)
+	if len(entries) == 0 {
+		s.log.Info("saga.no_compensations")
+		return
+	}
+
+	strategy, _ := getSagaState[int](s.state, fmt.Sprintf("%s:strategy", s.nsKey))
+	s.log.Info("saga.compensation.starting",
+		"count", len(entries),
+		"strategy", strategyName(CompensationStrategy(strategy)),
+		"original_error", origErr.Error())
+
+	if err := s.compensateGraph(origErr, entries, CompensationStrategy(strategy)); err != nil {
+		*errPtr = err
+		return
+	}
+
+	// All compensations succeeded
+	s.releaseLocks(entries)
+	s.state.clear(s.nsKey)
+	s.record(SagaTimelineEvent{Kind: SagaEventCompensationCompleted, At: s.lastNow()})
+	s.log.Info("saga.compensation.completed")
+}
+
+// compensateGraph runs compensations wave by wave. Each wave starts every
+// entry that has no outstanding dependents and is not backing off, then
+// waits for the whole wave. Attempts, backoff and DLQ escalation are
+// tracked per entry.
+func (s *SagaFramework) compensateGraph(origErr error, entries []SagaEntry, strategy CompensationStrategy) error {
+	s.strategy = strategy
+	deps := compensationGraph(entries)
+	dependents := make([]int, len(entries))
+	for _, ds := range deps {
+		for _, d := range ds {
+			dependents[d]++
+		}
+	}
+
+	done := make([]bool, len(entries))
+	backoff := make([]time.Duration, len(entries))
+	remaining := len(entries)
+
+	// limit is the attempt count at which an entry escalates; an operator
+	// retry raises it instead of resetting Attempt, so idempotency keys of
+	// earlier attempts are never reused
+	policy := s.cfg.compensationPolicy()
+	limit := make([]int, len(entries))
+	for idx := range limit {
+		limit[idx] = policy.MaxAttempts
+	}
+	lastErr := make([]error, len(entries))
+
+	// firstTry anchors the policy's MaxElapsed budget per entry
+	firstTry := make([]time.Time, len(entries))
+
+	// Timeline events are written once per wave, on the wave's journaled
+	// timestamps, rather than with a clock read and a state write each
+	s.batchTimeline = true
+	defer func() {
+		s.batchTimeline = false
+		s.flushTimeline()
+	}()
+
+	started := s.now()
+	s.record(SagaTimelineEvent{Kind: SagaEventCompensationStarted, Error: origErr.Error(), At: started})
+
+	var deadline restate.AfterFuture
+	if s.cfg.RollbackDeadline > 0 {
+		deadline = restate.After(s.ctx, s.cfg.RollbackDeadline)
+	}
+	breaches := 0
+
+	// deadlineBreached escalates a missed rollback deadline for each
+	// outstanding entry, the ones in flight or backing off, and re-arms it
+	// when the operators let the rollback continue. Any abort aborts; any
+	// retry re-arms the deadline; unanimous skips drop it.
+	deadlineBreached := func(outstanding []int) error {
+		breaches++
+		live, cursor := liveSagaEntries(entries, done, -1)
+		if len(outstanding) > 0 {
+			live, cursor = liveSagaEntries(entries, done, outstanding[0])
+		}
+		cause := fmt.Errorf("rollback deadline of %s exceeded", s.cfg.RollbackDeadline)
+		s.record(SagaTimelineEvent{Kind: SagaEventDeadlineExceeded, At: s.now(), Error: cause.Error()})
+		s.log.Error("saga.compensation.deadline_exceeded", "deadline", s.cfg.RollbackDeadline.String(), "remaining", remaining)
+
+		decision := SagaDecisionAbort
+		if s.cfg.Escalation != nil && len(outstanding) > 0 {
+			s.state.set(s.nsKey, live)
+			decision = SagaDecisionSkip
+			for _, idx := range outstanding {
+				d := s.escalateCompensation(entries[idx], cause, fmt.Sprintf("deadline-%d", breaches))
+				if d == SagaDecisionAbort {
+					decision = SagaDecisionAbort
+					break
+				}
+				if d == SagaDecisionRetry {
+					decision = SagaDecisionRetry
+				}
+			}
+		}
+		switch decision {
+		case SagaDecisionRetry:
+			deadline = restate.After(s.ctx, s.cfg.RollbackDeadline)
+			return nil
+		case SagaDecisionSkip:
+			deadline = nil
+			return nil
+		}
+		s.state.set(s.nsKey, live)
+		s.persistDLQ(origErr, cause, live, cursor)
+		return restate.TerminalError(fmt.Errorf("compensation deadline exceeded: %w", origErr), 500)
+	}
+
+	// Steps whose action never took effect are resolved without running
+	for idx, e := range entries {
+		if e.needsCompensation(strategy) {
+			continue
+		}
+		s.record(SagaTimelineEvent{
+			Kind: SagaEventCompensationSkipped, Step: e.Name, StepID: e.StepID,
+			Note: fmt.Sprintf("status %s", e.effectiveStatus()), At: started,
+		})
+		s.log.Info("saga.compensation.skipped", "name", e.Name, "status", e.effectiveStatus())
+		done[idx] = true
+		remaining--
+		for _, d := range deps[idx] {
+			dependents[d]--
+		}
+	}
+
+	for remaining > 0 {
+		var ready []int
+		nextDelay := time.Duration(-1)
+		for idx := len(entries) - 1; idx >= 0; idx-- {
+			if done[idx] || dependents[idx] > 0 {
+				continue
+			}
+			if backoff[idx] > 0 {
+				if nextDelay < 0 || backoff[idx] < nextDelay {
+					nextDelay = backoff[idx]
+				}
+				continue
+			}
+			ready = append(ready, idx)
+		}
+
+		// Every runnable entry is backing off: sleep until the earliest is due
+		if len(ready) == 0 {
+			timer := restate.After(s.ctx, nextDelay)
+			sleep := []restate.Future{timer}
+			if deadline != nil {
+				sleep = append(sleep, deadline)
+			}
+			winner, sleepErr := restate.WaitFirst(s.ctx, sleep...)
+			if sleepErr != nil {
+				s.log.Error("saga.sleep_failed", "err", sleepErr.Error())
+				live, _ := liveSagaEntries(entries, done, -1)
+				s.persistDLQ(origErr, sleepErr, live, len(live)-1)
+				return restate.TerminalError(fmt.Errorf("saga sleep failed: %w", origErr), 500)
+			}
+			if deadline != nil && winner == deadline {
+				var waiting []int
+				for idx := range backoff {
+					if !done[idx] && backoff[idx] > 0 {
+						waiting = append(waiting, idx)
+					}
+				}
+				if err := deadlineBreached(waiting); err != nil {
+					return err
+				}
+				// The pending backoff restarts from its full delay
+				continue
+			}
+			for idx := range backoff {
+				if backoff[idx] > 0 {
+					backoff[idx] -= nextDelay
+				}
+			}
+			continue
+		}
+
+		waveStart := s.now()
+		results := make([]func() error, len(ready))
+		pending := make([]restate.Future, len(ready))
+		timers := make([]restate.AfterFuture, len(ready))
+		timeouts := make([]time.Duration, len(ready))
+		for n, idx := range ready {
+			cur := entries[idx]
+
+			undo, ok := s.undo(cur.Name)
+			if !ok {
+				msg := fmt.Sprintf("missing compensation handler: %s", cur.Name)
+				s.log.Error("saga.missing_handler", "name", cur.Name)
+				live, cursor := liveSagaEntries(entries, done, idx)
+				s.persistDLQ(origErr, fmt.Errorf("%s", msg), live, cursor)
+				return restate.TerminalError(fmt.Errorf("%s: original=%w", msg, origErr), 500)
+			}
+
+			payload, err := s.payload(cur)
+			if err != nil {
+				s.log.Error("saga.payload_migration_failed", "name", cur.Name, "err", err.Error())
+				live, cursor := liveSagaEntries(entries, done, idx)
+				s.persistDLQ(origErr, err, live, cursor)
+				return restate.TerminalError(fmt.Errorf("%v: original=%w", err, origErr), 500)
+			}
+
+			if firstTry[idx].IsZero() {
+				firstTry[idx] = waveStart
+			}
+			s.record(SagaTimelineEvent{
+				Kind: SagaEventCompensationAttempt, Step: cur.Name, StepID: cur.StepID,
+				Attempt: cur.Attempt + 1, At: waveStart,
+			})
+			s.log.Info("saga.compensation.attempting", "name", cur.Name, "attempt", cur.Attempt+1)
+			fut, result, err := undo.start(s.ctx, cur, payload, sagaIdempotencyKey(s.nsKey, cur),
+				fmt.Sprintf("saga.compensate.%s", cur.Name), policy)
+			if err != nil {
+				s.log.Error("saga.compensation.start_failed", "name", cur.Name, "err", err.Error())
+				live, cursor := liveSagaEntries(entries, done, idx)
+				s.persistDLQ(origErr, err, live, cursor)
+				return restate.TerminalError(fmt.Errorf("%v: original=%w", err, origErr), 500)
+			}
+			pending[n], results[n] = fut, result
+			if timeouts[n] = s.compensationTimeout(cur, undo); timeouts[n] > 0 {
+				timers[n] = restate.After(s.ctx, timeouts[n])
+			}
+		}
+
+		// Race every attempt against its own timer and the rollback deadline
+		var escalated []int
+		outstanding := len(ready)
+		for outstanding > 0 {
+			race := make([]restate.Future, 0, 2*len(ready)+1)
+			for n := range ready {
+				if pending[n] == nil {
+					continue
+				}
+				race = append(race, pending[n])
+				if timers[n] != nil {
+					race = append(race, timers[n])
+				}
+			}
+			if deadline != nil {
+				race = append(race, deadline)
+			}
+
+			winner, waitErr := restate.WaitFirst(s.ctx, race...)
+			if waitErr != nil {
+				s.log.Error("saga.wait_failed", "err", waitErr.Error())
+				live, _ := liveSagaEntries(entries, done, -1)
+				s.persistDLQ(origErr, waitErr, live, len(live)-1)
+				return restate.TerminalError(fmt.Errorf("saga wait failed: %w", origErr), 500)
+			}
+			if deadline != nil && winner == deadline {
+				var inFlight []int
+				for n, idx := range ready {
+					if pending[n] != nil {
+						inFlight = append(inFlight, idx)
+					}
+				}
+				if err := deadlineBreached(inFlight); err != nil {
+					return err
+				}
+				continue
+			}
+
+			var runErr error
+			timedOut := false
+			n := futureIndex(pending, winner)
+			if n >= 0 {
+				runErr = results[n]()
+			} else {
+				n = timerIndex(timers, winner)
+				if n < 0 {
+					continue
+				}
+				timedOut = true
+				runErr = fmt.Errorf("compensation %s timed out after %s",
+					entries[ready[n]].Name, timeouts[n])
+			}
+			pending[n], timers[n] = nil, nil
+			outstanding--
+
+			// Outcomes are stamped with the wave's end once it has settled
+			idx := ready[n]
+			cur := &entries[idx]
+			if runErr == nil {
+				// Success: unblock the steps this one depended on
+				cur.ReattachAttempt = 0
+				done[idx] = true
+				remaining--
+				for _, d := range deps[idx] {
+					dependents[d]--
+				}
+				s.record(SagaTimelineEvent{
+					Kind: SagaEventCompensationSucceeded, Step: cur.Name, StepID: cur.StepID,
+					Attempt: cur.Attempt + 1,
+				})
+				s.log.Info("saga.compensation.succeeded", "name", cur.Name)
+				continue
+			}
+
+			// Failure: increment attempt counter. A timed-out call may still
+			// be running, so retries attach to it through its key.
+			cur.Attempt++
+			switch {
+			case !timedOut:
+				cur.ReattachAttempt = 0
+			case cur.ReattachAttempt == 0:
+				cur.ReattachAttempt = cur.Attempt
+			}
+			s.record(SagaTimelineEvent{
+				Kind: SagaEventCompensationFailed, Step: cur.Name, StepID: cur.StepID,
+				Attempt: cur.Attempt, Error: runErr.Error(),
+			})
+			s.log.Warn("saga.compensation.failed", "name", cur.Name, "attempt", cur.Attempt, "err", runErr.Error())
+
+			// Check whether the policy still allows a retry
+			reason := ""
+			var delay time.Duration
+			switch {
+			case !policy.Retryable(runErr):
+				reason = "non-retryable error"
+			case policy.MaxAttempts > 0 && cur.Attempt >= limit[idx]:
+				reason = "max retries exceeded"
+			default:
+				delay = policy.Delay(s.ctx, runErr, cur.Attempt)
+				if policy.MaxElapsed > 0 && waveStart.Sub(firstTry[idx])+delay > policy.MaxElapsed {
+					reason = "retry time budget exceeded"
+				}
+			}
+			if reason != "" {
+				if s.cfg.Escalation != nil {
+					// Decided once the rest of the wave has settled
+					escalated = append(escalated, idx)
+					lastErr[idx] = runErr
+					continue
+				}
+				msg := fmt.Errorf("%s for %s (attempts=%d): last_err=%w",
+					reason, cur.Name, cur.Attempt, runErr)
+				s.log.Error("saga.compensation.max_retries", "name", cur.Name, "attempts", cur.Attempt, "reason", reason)
+				live, cursor := liveSagaEntries(entries, done, idx)
+				s.state.set(s.nsKey, live)
+				s.persistDLQ(origErr, msg, live, cursor)
+				return restate.TerminalError(fmt.Errorf("compensation failed irrecoverably: %w", origErr), 500)
+			}
+
+			// Schedule backoff for this entry only
+			backoff[idx] = delay
+			s.record(SagaTimelineEvent{
+				Kind: SagaEventBackoff, Step: cur.Name, StepID: cur.StepID,
+				Attempt: cur.Attempt, Delay: backoff[idx],
+			})
+			s.log.Info("saga.compensation.retry_scheduled", "name", cur.Name, "delay", backoff[idx].String())
+		}
+
+		// Persist progress after every wave so a restart resumes from here
+		live, _ := liveSagaEntries(entries, done, -1)
+		s.state.set(s.nsKey, live)
+		waveEnd := s.now()
+		for i := range s.pendingEvents {
+			ev := &s.pendingEvents[i]
+			if ev.At.IsZero() && (ev.Kind == SagaEventCompensationSucceeded || ev.Kind == SagaEventCompensationFailed) {
+				ev.Duration = waveEnd.Sub(waveStart)
+			}
+		}
+		s.flushTimeline()
+
+		for _, idx := range escalated {
+			cur := &entries[idx]
+			switch s.escalateCompensation(*cur, lastErr[idx], "retries") {
+			case SagaDecisionRetry:
+				limit[idx] = cur.Attempt + policy.MaxAttempts
+				firstTry[idx] = time.Time{}
+			case SagaDecisionSkip:
+				done[idx] = true
+				remaining--
+				for _, d := range deps[idx] {
+					dependents[d]--
+				}
+			default:
+				msg := fmt.Errorf("compensation of %s aborted by operator (attempts=%d): last_err=%w",
+					cur.Name, cur.Attempt, lastErr[idx])
+				live, cursor := liveSagaEntries(entries, done, idx)
+				s.state.set(s.nsKey, live)
+				s.persistDLQ(origErr, msg, live, cursor)
+				return restate.TerminalError(fmt.Errorf("compensation failed irrecoverably: %w", origErr), 500)
+			}
+		}
+		if len(escalated) > 0 {
+			live, _ := liveSagaEntries(entries, done, -1)
+			s.state.set(s.nsKey, live)
+		}
+	}
+
+	return nil
+}
+
+// escalateCompensation notifies operators about an exhausted compensation
+// and waits for their decision. The saga's entries are persisted before
+// the wait, so the saga resumes from the same cursor whatever is decided.
+// tag distinguishes escalations of the same attempt in promise names.
+func (s *SagaFramework) escalateCompensation(entry SagaEntry, cause error, tag string) SagaEscalationDecision {
+	policy := s.cfg.Escalation
+	esc := SagaCompensationEscalation{
+		SagaName: s.name,
+		SagaKey:  s.nsKey,
+		Step:     entry.Name,
+		StepID:   entry.StepID,
+		Attempt:  entry.Attempt,
+		Error:    cause.Error(),
+	}
+
+	timeout := policy.Timeout
+	if timeout <= 0 {
+		timeout = 24 * time.Hour
+	}
+	fallback := policy.TimeoutDecision
+	if fallback == "" {
+		fallback = SagaDecisionAbort
+	}
+
+	var (
+		decision SagaEscalationDecision
+		timedOut bool
+		err      error
+	)
+	wctx, isWorkflow := s.ctx.(restate.WorkflowContext)
+	if policy.UsePromise && isWorkflow {
+		esc.PromiseName = fmt.Sprintf("saga-escalation/%s/%s/%d/%s", s.nsKey, entry.StepID, entry.Attempt, tag)
+		s.notifyCompensationEscalation(esc)
+		var res PromiseRaceResult[SagaEscalationDecision]
+		res, err = RacePromiseWithTimeout[SagaEscalationDecision](wctx, esc.PromiseName, timeout)
+		decision, timedOut = res.Value, res.TimedOut
+	} else {
+		awakeable := WaitForExternalSignal[SagaEscalationDecision](s.ctx)
+		esc.AwakeableID = awakeable.Id()
+		s.notifyCompensationEscalation(esc)
+		decision, timedOut, err = RaceAwakeableWithTimeout(s.ctx, awakeable, timeout, fallback)
+	}
+
+	switch {
+	case err != nil:
+		s.log.Warn("saga.escalation.failed", "name", entry.Name, "err", err.Error())
+		decision = SagaDecisionAbort
+	case timedOut:
+		decision = fallback
+	case decision != SagaDecisionRetry && decision != SagaDecisionSkip && decision != SagaDecisionAbort:
+		s.log.Warn("saga.escalation.unknown_decision", "name", entry.Name, "decision", decision)
+		decision = SagaDecisionAbort
+	}
+
+	s.record(SagaTimelineEvent{
+		Kind: SagaEventEscalationResolved, Step: entry.Name, StepID: entry.StepID,
+		Attempt: entry.Attempt, At: s.now(), Note: string(decision),
+	})
+	s.log.Info("saga.escalation.resolved", "name", entry.Name, "decision", decision, "timed_out", timedOut)
+	return decision
+}
+
+// compensationTimeout is the time bound for one attempt of entry, which
+// only remote compensations get.
+func (s *SagaFramework) compensationTimeout(entry SagaEntry, undo sagaUndo) time.Duration {
+	if undo.remote == nil {
+		return 0
+	}
+	if entry.Timeout > 0 {
+		return entry.Timeout
+	}
+	return s.cfg.CompensationTimeout
+}
+
+// notifyCompensationEscalation records the escalation and invokes Notify durably.
+func (s *SagaFramework) notifyCompensationEscalation(esc SagaCompensationEscalation) {
+	s.record(SagaTimelineEvent{
+		Kind: SagaEventEscalated, Step: esc.Step, StepID: esc.StepID,
+		Attempt: esc.Attempt, At: s.now(), Error: esc.Error,
+	})
+	// Operators read the timeline while deciding
+	s.flushTimeline()
+	s.log.Error("saga.compensation.escalated", "name", esc.Step,
+		"awakeable_id", esc.AwakeableID, "promise", esc.PromiseName)
+	if s.cfg.Escalation.Notify == nil {
+		return
+	}
+	if err := RunDoVoid(s.ctx, func(rc restate.RunContext) error {
+		return s.cfg.Escalation.Notify(rc, esc)
+	}, restate.WithName("saga.escalation.notify")); err != nil {
+		s.log.Warn("saga.escalation.notify_failed", "err", err.Error())
+	}
+}
+
+// compensationGraph resolves the forward dependencies of each saga entry.
+// deps[i] lists the indexes of earlier entries that entry i builds on, so
+// entry i must be compensated before any of them.
+func compensationGraph(entries []SagaEntry) [][]int {
+	deps := make([][]int, len(entries))
+	var frontier, groupBase []int
+	openGroup := ""
+
+	for i, e := range entries {
+		switch {
+		case e.Group != "" && e.Group == openGroup:
+			// Sibling in the open group: shares the group's predecessors
+			deps[i] = append([]int(nil), groupBase...)
+			frontier = append(frontier, i)
+		case e.Group != "":
+			// First member of a new group
+			groupBase = frontier
+			deps[i] = append([]int(nil), groupBase...)
+			frontier = []int{i}
+		default:
+			// Ungrouped step: depends on everything added just before it
+			deps[i] = append([]int(nil), frontier...)
+			frontier = []int{i}
+		}
+		openGroup = e.Group
+
+		if len(e.DependsOn) > 0 {
+			deps[i] = nil
+			for j := 0; j < i; j++ {
+				for _, name := range e.DependsOn {
+					if entries[j].Name == name {
+						deps[i] = append(deps[i], j)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	return deps
+}
+
+// liveSagaEntries returns the entries not yet compensated and the position
+// of entry idx within that list (or -1 if idx is negative or done).
+func liveSagaEntries(entries []SagaEntry, done []bool, idx int) ([]SagaEntry, int) {
+	live := make([]SagaEntry, 0, len(entries))
+	cursor := -1
+	for i, e := range entries {
+		if done[i] {
+			continue
+		}
+		if i == idx {
+			cursor = len(live)
+		}
+		live = append(live, e)
+	}
+	return live, cursor
+}
+
+// hasSagaEntry reports whether a step with the given name has been added.
+func hasSagaEntry(entries []SagaEntry, name string) bool {
+	for _, e := range entries {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSagaStepOptions folds variadic step options into one.
+func mergeSagaStepOptions(opts []SagaStepOption) SagaStepOption {
+	var merged SagaStepOption
+	for _, opt := range opts {
+		merged.DependsOn = append(merged.DependsOn, opt.DependsOn...)
+		merged.Locks = append(merged.Locks, opt.Locks...)
+		if opt.Timeout > 0 {
+			merged.Timeout = opt.Timeout
+		}
+		if opt.Group != "" {
+			merged.Group = opt.Group
+		}
+	}
+	return merged
+}
+
+// RecoverIfNeeded resolves a failed saga according to SagaConfig.RecoveryMode.
+//
+// In backward mode it is identical to CompensateIfNeeded. In forward mode it
+// re-drives every step that is not yet completed, in the order the steps were
+// added, with durable exponential backoff. If every step completes, *errPtr
+// is cleared and the business process is considered done. Forward mode
+// expects the whole plan to be added up front:
+//
+//	saga.RegisterForward("book_ledger", bookLedger)
+//	saga.Add("book_ledger", entry, true)
+//	saga.Add("notify_bank", notice, true)
+//	defer saga.RecoverIfNeeded(&err)
+func (s *SagaFramework) RecoverIfNeeded(errPtr *error) {
+	defer s.release()
+	if errPtr == nil || *errPtr == nil {
+		s.settle()
+		return
+	}
+	if s.cfg.RecoveryMode != SagaRecoveryForward {
+		s.CompensateIfNeeded(errPtr)
+		return
+	}
+
+	origErr := *errPtr
+	entries, _ := getSagaState[[]SagaEntry](s.state, s.nsKey)
+	s.log.Info("saga.forward.starting", "count", len(entries), "original_error", origErr.Error())
+
+	// limit is the attempt count at which a step escalates; an operator
+	// resume raises it by a full round instead of resetting Attempt
+	policy := s.cfg.forwardPolicy()
+	for idx := range entries {
+		if entries[idx].effectiveStatus() == SagaStepCompleted {
+			continue
+		}
+
+		limit := policy.MaxAttempts
+		for {
+			err := s.driveForward(entries, idx, policy, limit)
+			if err == nil {
+				break
+			}
+			s.log.Error("saga.forward.impossible", "name", entries[idx].Name, "err", err.Error())
+			if !s.escalateForward(entries, idx, err) {
+				s.CompensateIfNeeded(errPtr)
+				return
+			}
+			// Operator asked for another round on the same step
+			if policy.MaxAttempts > 0 {
+				limit = entries[idx].Attempt + policy.MaxAttempts
+			}
+		}
+	}
+
+	s.log.Info("saga.forward.completed", "original_error", origErr.Error())
+	*errPtr = nil
+	s.settle()
+}
+
+// driveForward re-runs one step's forward action until it succeeds, fails
+// with an error the forward policy does not retry, or reaches limit
+// attempts (zero is unlimited).
+func (s *SagaFramework) driveForward(entries []SagaEntry, idx int, policy RetryPolicy, limit int) error {
+	cur := &entries[idx]
+	fn, ok := s.forward[cur.Name]
+	if !ok {
+		return fmt.Errorf("missing forward handler: %s", cur.Name)
+	}
+	payload, err := s.payload(*cur)
+	if err != nil {
+		return err
+	}
+
+	var started time.Time
+	if policy.MaxElapsed > 0 {
+		started = s.now()
+	}
+
+	for {
+		s.log.Info("saga.forward.attempting", "name", cur.Name, "attempt", cur.Attempt+1)
+		_, runErr := runAttempt(s.ctx, policy, cur.Attempt+1, func(rc restate.RunContext) (restate.Void, error) {
+			return restate.Void{}, fn(rc, payload)
+		}, restate.WithName(fmt.Sprintf("saga.forward.%s", cur.Name)))
+
+		if runErr == nil {
+			cur.Status = SagaStepCompleted
+			s.state.set(s.nsKey, entries)
+			s.log.Info("saga.forward.succeeded", "name", cur.Name)
+			return nil
+		}
+
+		cur.Attempt++
+		s.state.set(s.nsKey, entries)
+		s.log.Warn("saga.forward.failed", "name", cur.Name, "attempt", cur.Attempt, "err", runErr.Error())
+
+		if !policy.Retryable(runErr) {
+			return fmt.Errorf("forward step %s failed with a non-retryable error: %w", cur.Name, runErr)
+		}
+		retry := limit <= 0 || cur.Attempt < limit
+		delay := time.Duration(0)
+		if retry {
+			delay = policy.Delay(s.ctx, runErr, cur.Attempt)
+			if !started.IsZero() && s.now().Sub(started)+delay > policy.MaxElapsed {
+				retry = false
+			}
+		}
+		if !retry {
+			return fmt.Errorf("forward retries exceeded for %s (attempts=%d): last_err=%w",
+				cur.Name, cur.Attempt, runErr)
+		}
+
+		s.log.Info("saga.forward.retry_scheduled", "name", cur.Name, "delay", delay.String())
+		if sleepErr := restate.Sleep(s.ctx, delay); sleepErr != nil {
+			return sleepErr
+		}
+	}
+}
+
+// escalateForward applies ForwardFallback and reports whether the operator
+// asked to keep pushing forward.
+func (s *SagaFramework) escalateForward(entries []SagaEntry, idx int, cause error) bool {
+	cur := entries[idx]
+	esc := SagaForwardEscalation{
+		SagaName: s.name,
+		SagaKey:  s.nsKey,
+		Step:     cur.Name,
+		StepID:   cur.StepID,
+		Attempt:  cur.Attempt,
+		Error:    cause.Error(),
+	}
+
+	if s.cfg.ForwardFallback != ForwardFallbackHuman {
+		s.notifyForwardEscalation(esc)
+		return false
+	}
+
+	awakeable := WaitForExternalSignal[bool](s.ctx)
+	esc.AwakeableID = awakeable.Id()
+	s.notifyForwardEscalation(esc)
+
+	timeout := s.cfg.HumanTimeout
+	if timeout <= 0 {
+		timeout = 24 * time.Hour
+	}
+	resume, timedOut, err := RaceAwakeableWithTimeout(s.ctx, awakeable, timeout, false)
+	if err != nil || timedOut {
+		s.log.Warn("saga.forward.escalation_unanswered", "name", cur.Name, "timed_out", timedOut)
+		return false
+	}
+	s.log.Info("saga.forward.escalation_answered", "name", cur.Name, "resume", resume)
+	return resume
+}
+
+// notifyForwardEscalation invokes OnForwardEscalation durably, if configured.
+func (s *SagaFramework) notifyForwardEscalation(esc SagaForwardEscalation) {
+	s.log.Error("saga.forward.escalated", "name", esc.Step, "awakeable_id", esc.AwakeableID)
+	if s.cfg.OnForwardEscalation == nil {
+		return
+	}
+	if err := RunDoVoid(s.ctx, func(rc restate.RunContext) error {
+		return s.cfg.OnForwardEscalation(rc, esc)
+	}, restate.WithName("saga.forward.notify")); err != nil {
+		s.log.Warn("saga.forward.notify_failed", "err", err.Error())
+	}
+}
+
+// persistDLQ records irrecoverable compensation failures to dead-letter queue.
+//
+// The record is appended to the workflow's own DLQ list and, when
+// SagaConfig.DLQService is set, sent to the SagaDLQ Virtual Object so it
+// can be listed, retried or discarded from outside the workflow.
+func (s *SagaFramework) persistDLQ(originalErr, escalationErr error, entries []SagaEntry, cursor int) {
+	id := restate.UUID(s.ctx).String()
+
+	// Capture wall-clock and host details once so replays see the same record
+	record, err := RunDo(s.ctx, func(rc restate.RunContext) (SagaDLQRecord, error) {
+		return SagaDLQRecord{
+			ID:                         id,
+			SagaName:                   s.name,
+			SagaKey:                    s.nsKey,
+			WorkflowKey:                s.key,
+			OriginalError:              originalErr.Error(),
+			EscalationError:            escalationErr.Error(),
+			Entries:                    entries,
+			Cursor:                     cursor,
+			Timestamp:                  time.Now(),
+			Hostname:                   os.Getenv("HOSTNAME"),
+			RequiresManualIntervention: true,
+			Status:                     SagaDLQOpen,
+			Strategy:                   s.strategy,
+		}, nil
+	}, restate.WithName("saga.persist_dlq"))
+	if err != nil {
+		s.log.Error("saga.dlq_record_failed", "err", err.Error())
+		return
+	}
+
+	records, err := s.dlqRecords()
+	if err != nil {
+		s.log.Error("saga.dlq_read_failed", "dlq_key", s.dlqKey, "err", err.Error())
+		return
+	}
+	records = append(records, record)
+	s.state.set(s.dlqKey, records)
+
+	event := SagaTimelineEvent{Kind: SagaEventDLQEscalated, At: record.Timestamp, Error: record.EscalationError, DLQID: record.ID}
+	if cursor >= 0 && cursor < len(entries) {
+		event.Step, event.StepID, event.Attempt = entries[cursor].Name, entries[cursor].StepID, entries[cursor].Attempt
+	}
+	s.record(event)
+
+	if s.cfg.DLQService != "" {
+		ObjectClient[SagaDLQRecord, SagaDLQRecord]{
+			ServiceName: s.cfg.DLQService,
+			HandlerName: "Append",
+		}.Send(s.ctx, s.name, record)
+	}
+
+	s.log.Error("saga.dlq_recorded", "dlq_key", s.dlqKey, "dlq_id", record.ID, "dlq_service", s.cfg.DLQService)
+}
+
+// dlqRecords reads the workflow's DLQ list. Earlier releases stored a single
+// record as a JSON blob under the same key; such a blob is decoded into a
+// record so it is kept when the next failure is appended.
+func (s *SagaFramework) dlqRecords() ([]SagaDLQRecord, error) {
+	records, err := getSagaState[[]SagaDLQRecord](s.state, s.dlqKey)
+	if err == nil {
+		return records, nil
+	}
+	blob, blobErr := getSagaState[[]byte](s.state, s.dlqKey)
+	if blobErr != nil || len(blob) == 0 {
+		return nil, err
+	}
+	var legacy SagaDLQRecord
+	if decodeErr := json.Unmarshal(blob, &legacy); decodeErr != nil {
+		return nil, fmt.Errorf("decode legacy dlq record %s: %w", s.dlqKey, decodeErr)
+	}
+	legacy.ID = "legacy-" + deterministicStepID(s.dlqKey, blob)
+	legacy.SagaName, legacy.WorkflowKey = s.name, s.key
+	legacy.Status = SagaDLQOpen
+	return []SagaDLQRecord{legacy}, nil
+}
+
+// -----------------------------------------------------------------------------
+// Section 4A: Saga Dead-Letter Queue
+// -----------------------------------------------------------------------------
+
+// SagaDLQServiceName is the service name SagaDLQ is bound under by restate.Reflect.
+const SagaDLQServiceName = "SagaDLQ"
+
+// SagaDLQStatus tracks what on-call has done with a dead-lettered failure.
+type SagaDLQStatus string
+
+const (
+	// SagaDLQOpen means the failure still needs manual intervention
+	SagaDLQOpen SagaDLQStatus = "open"
+
+	// SagaDLQResolved means a retry compensated every remaining step
+	SagaDLQResolved SagaDLQStatus = "resolved"
+)
+
+// SagaDLQRecord is an irrecoverable compensation failure.
+type SagaDLQRecord struct {
+	ID                         string        `json:"id"`
+	SagaName                   string        `json:"saga_name"`
+	SagaKey                    string        `json:"saga_key"`
+	WorkflowKey                string        `json:"workflow_key"`
+	OriginalError              string        `json:"original_error"`
+	EscalationError            string        `json:"escalation_error"`
+	Entries                    []SagaEntry   `json:"entries"`
+	Cursor                     int           `json:"cursor"`
+	Timestamp                  time.Time     `json:"timestamp"`
+	Hostname                   string        `json:"hostname"`
+	RequiresManualIntervention bool          `json:"requires_manual_intervention"`
+	Status                     SagaDLQStatus `json:"status"`
+	RetryCount                 int           `json:"retry_count"`
+	LastRetryError             string        `json:"last_retry_error,omitempty"`
+	ResolvedAt                 time.Time     `json:"resolved_at"`
+
+	// Strategy is the compensation strategy of the failed saga; a retry
+	// skips the same steps it would have skipped
+	Strategy CompensationStrategy `json:"strategy"`
+}
+
+// SagaDLQDiscardRequest removes a record without compensating it.
+type SagaDLQDiscardRequest struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// SagaRegistryReport lists step names in open DLQ records and those that no
+// longer resolve to a registered compensation.
+type SagaRegistryReport struct {
+	SagaName   string   `json:"saga_name"`
+	Steps      []string `json:"steps"`
+	Unresolved []string `json:"unresolved"`
+}
+
+var (
+	// sagaCompensations holds handlers usable outside the workflow that added
+	// the step, keyed by saga name then step name.
+	sagaCompensations   = make(map[string]map[string]SagaCompensationFunc)
+	sagaRemotes         = make(map[string]map[string]SagaHandlerRef)
+	sagaSchemas         = make(map[string]map[string]*sagaSchema)
+	sagaAliases         = make(map[string]map[string]string)
+	sagaDeprecations    = make(map[string]map[string]string)
+	sagaCompensationsMu sync.RWMutex
+)
+
+// maxSagaAliasHops bounds alias chains so a cycle cannot loop forever.
+const maxSagaAliasHops = 8
+
+// RegisterSagaCompensation makes a compensation handler available process-wide.
+//
+// SagaDLQ can only retry steps whose handlers are registered here, because the
+// closures passed to SagaFramework.Register live inside a single invocation.
+// Call it during startup, before binding services:
+//
+//	framework.RegisterSagaCompensation("checkout", "refund_payment", refundPayment)
+func RegisterSagaCompensation(sagaName, stepName string, fn SagaCompensationFunc) {
+	if fn == nil {
+		slog.Warn("saga.register_global: nil handler ignored", "saga", sagaName, "name", stepName)
+		return
+	}
+	sagaCompensationsMu.Lock()
+	defer sagaCompensationsMu.Unlock()
+	if sagaCompensations[sagaName] == nil {
+		sagaCompensations[sagaName] = make(map[string]SagaCompensationFunc)
+	}
+	sagaCompensations[sagaName][stepName] = fn
+}
+
+// RegisterTypedSagaCompensation is the process-wide counterpart of RegisterTyped.
+func RegisterTypedSagaCompensation[P any](sagaName, stepName string, version int, fn func(rc restate.RunContext, payload P) error) {
+	if fn == nil {
+		slog.Warn("saga.register_global: nil handler ignored", "saga", sagaName, "name", stepName)
+		return
+	}
+	RegisterSagaCompensation(sagaName, stepName, typedCompensation(stepName, fn))
+
+	sagaCompensationsMu.Lock()
+	defer sagaCompensationsMu.Unlock()
+	sc := globalSagaSchema(sagaName, stepName)
+	sc.version = version
+	sc.payloadType = reflect.TypeFor[P]()
+}
+
+// RegisterSagaUpcaster is the process-wide counterpart of SagaFramework.RegisterUpcaster.
+func RegisterSagaUpcaster(sagaName, stepName string, fromVersion int, fn SagaUpcaster) {
+	if fn == nil {
+		slog.Warn("saga.register_upcaster: nil upcaster ignored", "saga", sagaName, "name", stepName)
+		return
+	}
+	sagaCompensationsMu.Lock()
+	defer sagaCompensationsMu.Unlock()
+	globalSagaSchema(sagaName, stepName).upcasters[fromVersion] = fn
+}
+
+// globalSagaSchema returns the process-wide schema, creating it if needed.
+// Callers must hold sagaCompensationsMu.
+func globalSagaSchema(sagaName, stepName string) *sagaSchema {
+	if sagaSchemas[sagaName] == nil {
+		sagaSchemas[sagaName] = make(map[string]*sagaSchema)
+	}
+	sc, ok := sagaSchemas[sagaName][stepName]
+	if !ok {
+		sc = &sagaSchema{upcasters: make(map[int]SagaUpcaster)}
+		sagaSchemas[sagaName][stepName] = sc
+	}
+	return sc
+}
+
+// lookupSagaSchema finds a schema registered process-wide, or nil.
+func lookupSagaSchema(sagaName, stepName string) *sagaSchema {
+	sagaCompensationsMu.RLock()
+	defer sagaCompensationsMu.RUnlock()
+	return sagaSchemas[sagaName][stepName]
+}
+
+// RegisterRemoteSagaCompensation is the process-wide counterpart of
+// SagaFramework.RegisterRemote, so SagaDLQ can retry remote compensations.
+func RegisterRemoteSagaCompensation(sagaName, stepName string, ref SagaHandlerRef) {
+	if ref.ServiceName == "" || ref.HandlerName == "" {
+		slog.Warn("saga.register_remote: incomplete handler reference ignored", "saga", sagaName, "name", stepName)
+		return
+	}
+	sagaCompensationsMu.Lock()
+	defer sagaCompensationsMu.Unlock()
+	if sagaRemotes[sagaName] == nil {
+		sagaRemotes[sagaName] = make(map[string]SagaHandlerRef)
+	}
+	sagaRemotes[sagaName][stepName] = ref
+}
+
+// RegisterSagaAlias is the process-wide counterpart of SagaFramework.Alias,
+// so SagaDLQ and ValidateSagaRegistry resolve renamed handlers too.
+func RegisterSagaAlias(sagaName, oldName, newName string) {
+	if oldName == "" || newName == "" || oldName == newName {
+		slog.Warn("saga.alias: invalid alias ignored", "saga", sagaName, "old", oldName, "new", newName)
+		return
+	}
+	sagaCompensationsMu.Lock()
+	defer sagaCompensationsMu.Unlock()
+	if sagaAliases[sagaName] == nil {
+		sagaAliases[sagaName] = make(map[string]string)
+	}
+	sagaAliases[sagaName][oldName] = newName
+}
+
+// DeprecateSagaCompensation is the process-wide counterpart of SagaFramework.Deprecate.
+func DeprecateSagaCompensation(sagaName, stepName, reason string) {
+	sagaCompensationsMu.Lock()
+	defer sagaCompensationsMu.Unlock()
+	if sagaDeprecations[sagaName] == nil {
+		sagaDeprecations[sagaName] = make(map[string]string)
+	}
+	sagaDeprecations[sagaName][stepName] = reason
+}
+
+// resolveSagaAlias follows process-wide aliases to the current step name.
+func resolveSagaAlias(sagaName, stepName string) string {
+	sagaCompensationsMu.RLock()
+	defer sagaCompensationsMu.RUnlock()
+	for hops := 0; hops < maxSagaAliasHops; hops++ {
+		next, ok := sagaAliases[sagaName][stepName]
+		if !ok {
+			break
+		}
+		stepName = next
+	}
+	return stepName
+}
+
+// lookupSagaDeprecation reports a process-wide deprecation.
+func lookupSagaDeprecation(sagaName, stepName string) (string, bool) {
+	sagaCompensationsMu.RLock()
+	defer sagaCompensationsMu.RUnlock()
+	reason, ok := sagaDeprecations[sagaName][stepName]
+	return reason, ok
+}
+
+// ValidateSagaRegistry checks that every step name found in persisted
+// entries still resolves to a process-wide compensation, directly or through
+// an alias. Each unresolved name raises the "saga_compensation_unresolved"
+// guardrail, so under PolicyStrict a handler renamed without an alias fails
+// deployment instead of sending every in-flight saga to the DLQ:
+//
+//	names := framework.SagaStepNames(entries)
+//	if err := framework.ValidateSagaRegistry("checkout", names, slog.Default()); err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// Only process-wide registrations (RegisterSagaCompensation and friends)
+// count: handlers registered on a saga with Register exist only inside the
+// invocation that created it. Sagas that register per instance validate
+// with SagaFramework.ValidateRegistry instead.
+func ValidateSagaRegistry(sagaName string, persisted []string, logger *slog.Logger) error {
+	return reportUnresolvedSagaSteps(sagaName, persisted, unresolvedSagaSteps(sagaName, persisted), logger)
+}
+
+// ValidateRegistry is ValidateSagaRegistry for one saga instance: a step
+// name resolves through the instance's own handlers as well as the
+// process-wide ones.
+func (s *SagaFramework) ValidateRegistry(persisted []string) error {
+	var missing []string
+	for _, name := range dedupeStrings(persisted) {
+		if _, ok := s.undo(name); !ok {
+			missing = append(missing, name)
+		}
+	}
+	return reportUnresolvedSagaSteps(s.name, persisted, missing, s.log)
+}
+
+// reportUnresolvedSagaSteps raises a guardrail per missing name and logs
+// deprecated handlers still in use.
+func reportUnresolvedSagaSteps(sagaName string, persisted, missing []string, logger *slog.Logger) error {
+	var errs []error
+	for _, name := range missing {
+		violation := GuardrailViolation{
+			Check:    "saga_compensation_unresolved",
+			Message:  fmt.Sprintf("persisted saga step %s/%s has no registered compensation or alias", sagaName, name),
+			Severity: "error",
+		}
+		if err := HandleGuardrailViolation(violation, logger, ""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, name := range dedupeStrings(persisted) {
+		if reason, ok := lookupSagaDeprecation(sagaName, resolveSagaAlias(sagaName, name)); ok && logger != nil {
+			logger.Info("saga.registry.deprecated_in_use", "saga", sagaName, "name", name, "reason", reason)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SagaStepNames lists the distinct step names in entries, in first-seen order.
+func SagaStepNames(entries []SagaEntry) []string {
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return dedupeStrings(names)
+}
+
+// unresolvedSagaSteps returns the names with no process-wide compensation.
+func unresolvedSagaSteps(sagaName string, names []string) []string {
+	var missing []string
+	for _, name := range dedupeStrings(names) {
+		if _, ok := lookupSagaUndo(sagaName, resolveSagaAlias(sagaName, name)); !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// lookupSagaUndo resolves a process-wide compensation, local closures first.
+func lookupSagaUndo(sagaName, stepName string) (sagaUndo, bool) {
+	if fn, ok := lookupSagaCompensation(sagaName, stepName); ok {
+		return sagaUndo{local: fn}, true
+	}
+	sagaCompensationsMu.RLock()
+	defer sagaCompensationsMu.RUnlock()
+	if ref, ok := sagaRemotes[sagaName][stepName]; ok {
+		return sagaUndo{remote: &ref}, true
+	}
+	return sagaUndo{}, false
+}
+
+// lookupSagaCompensation finds a handler registered via RegisterSagaCompensation.
+func lookupSagaCompensation(sagaName, stepName string) (SagaCompensationFunc, bool) {
+	sagaCompensationsMu.RLock()
+	defer sagaCompensationsMu.RUnlock()
+	fn, ok := sagaCompensations[sagaName][stepName]
+	return fn, ok
+}
+
+// SagaDLQ is a Virtual Object, keyed by saga name, that collects compensation
+// failures so on-call can list, inspect, retry and discard them.
+//
+// It is opt-in: bind it next to your workflows and point
+// SagaConfig.DLQService at it.
+//
+//	server.NewRestate().Bind(restate.Reflect(framework.NewSagaDLQ(metrics)))
+//	cfg.DLQService = framework.SagaDLQServiceName
+type SagaDLQ struct {
+	metrics *MetricsCollector
+}
+
+// NewSagaDLQ creates the DLQ service. metrics may be nil.
+func NewSagaDLQ(metrics *MetricsCollector) *SagaDLQ {
+	return &SagaDLQ{metrics: metrics}
+}
+
+const sagaDLQRecordsKey = "records"
+
+// Append stores a failure record. Records are deduplicated by ID.
+func (d *SagaDLQ) Append(ctx restate.ObjectContext, record SagaDLQRecord) (SagaDLQRecord, error) {
+	records, err := restate.Get[[]SagaDLQRecord](ctx, sagaDLQRecordsKey)
+	if err != nil {
+		return SagaDLQRecord{}, err
+	}
+
+	for _, r := range records {
+		if r.ID == record.ID {
+			return r, nil
+		}
+	}
+
+	if record.Status == "" {
+		record.Status = SagaDLQOpen
+	}
+	records = append(records, record)
+	restate.Set(ctx, sagaDLQRecordsKey, records)
+
+	ctx.Log().Error("saga.dlq.appended",
+		"saga", restate.Key(ctx),
+		"dlq_id", record.ID,
+		"saga_key", record.SagaKey,
+		"escalation_error", record.EscalationError)
+	d.recordMetrics(ctx, restate.Key(ctx), "appended", records)
+	return record, nil
+}
+
+// List returns every record for this saga, oldest first.
+func (d *SagaDLQ) List(ctx restate.ObjectSharedContext) ([]SagaDLQRecord, error) {
+	records, err := restate.Get[[]SagaDLQRecord](ctx, sagaDLQRecordsKey)
+	if err != nil {
+		return nil, err
+	}
+	if records == nil {
+		records = []SagaDLQRecord{}
+	}
+	return records, nil
+}
+
+// CheckRegistry verifies that every step in an open record can still be
+// retried by this deployment, following aliases.
+func (d *SagaDLQ) CheckRegistry(ctx restate.ObjectSharedContext) (SagaRegistryReport, error) {
+	records, err := restate.Get[[]SagaDLQRecord](ctx, sagaDLQRecordsKey)
+	if err != nil {
+		return SagaRegistryReport{}, err
+	}
+
+	sagaName := restate.Key(ctx)
+	var names []string
+	for _, r := range records {
+		if r.Status == SagaDLQOpen {
+			names = append(names, SagaStepNames(r.Entries)...)
+		}
+	}
+	report := SagaRegistryReport{
+		SagaName:   sagaName,
+		Steps:      dedupeStrings(names),
+		Unresolved: unresolvedSagaSteps(sagaName, names),
+	}
+	if report.Unresolved == nil {
+		report.Unresolved = []string{}
+	}
+	return report, nil
+}
+
+// Inspect returns a single record by ID.
+func (d *SagaDLQ) Inspect(ctx restate.ObjectSharedContext, id string) (SagaDLQRecord, error) {
+	records, err := restate.Get[[]SagaDLQRecord](ctx, sagaDLQRecordsKey)
+	if err != nil {
+		return SagaDLQRecord{}, err
+	}
+	idx := findSagaDLQRecord(records, id)
+	if idx < 0 {
+		return SagaDLQRecord{}, restate.TerminalError(fmt.Errorf("saga dlq record not found: %s", id), 404)
+	}
+	return records[idx], nil
+}
+
+// Retry re-runs the remaining compensations of a record, starting at the
+// recorded cursor and honouring the step dependency graph. Progress is
+// saved after every step, so a failed retry resumes where it stopped.
+// The returned record reports the outcome; a failed compensation is
+// reported through LastRetryError rather than as a handler error.
+func (d *SagaDLQ) Retry(ctx restate.ObjectContext, id string) (SagaDLQRecord, error) {
+	records, err := restate.Get[[]SagaDLQRecord](ctx, sagaDLQRecordsKey)
+	if err != nil {
+		return SagaDLQRecord{}, err
+	}
+	idx := findSagaDLQRecord(records, id)
+	if idx < 0 {
+		return SagaDLQRecord{}, restate.TerminalError(fmt.Errorf("saga dlq record not found: %s", id), 404)
+	}
+
+	record := records[idx]
+	if record.Status == SagaDLQResolved {
+		return record, nil
+	}
+
+	sagaName := restate.Key(ctx)
+	record.RetryCount++
+	ctx.Log().Info("saga.dlq.retrying", "saga", sagaName, "dlq_id", id, "remaining", len(record.Entries))
+
+	retryErr := d.compensate(ctx, sagaName, &record)
+	if retryErr != nil {
+		record.LastRetryError = retryErr.Error()
+		ctx.Log().Warn("saga.dlq.retry_failed", "saga", sagaName, "dlq_id", id, "err", retryErr.Error())
+		d.recordMetrics(ctx, sagaName, "retry_failed", records)
+	} else {
+		resolvedAt, err := RunDo(ctx, func(rc restate.RunContext) (time.Time, error) {
+			return time.Now(), nil
+		}, restate.WithName("saga.dlq.resolved_at"))
+		if err != nil {
+			return SagaDLQRecord{}, err
+		}
+		record.Status = SagaDLQResolved
+		record.RequiresManualIntervention = false
+		record.LastRetryError = ""
+		record.ResolvedAt = resolvedAt
+		ctx.Log().Info("saga.dlq.resolved", "saga", sagaName, "dlq_id", id)
+	}
+
+	records[idx] = record
+	restate.Set(ctx, sagaDLQRecordsKey, records)
+	if retryErr == nil {
+		d.recordMetrics(ctx, sagaName, "resolved", records)
+	}
+	return record, nil
+}
+
+// Discard drops a record without compensating it.
+func (d *SagaDLQ) Discard(ctx restate.ObjectContext, req SagaDLQDiscardRequest) (restate.Void, error) {
+	records, err := restate.Get[[]SagaDLQRecord](ctx, sagaDLQRecordsKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	idx := findSagaDLQRecord(records, req.ID)
+	if idx < 0 {
+		return restate.Void{}, restate.TerminalError(fmt.Errorf("saga dlq record not found: %s", req.ID), 404)
+	}
+
+	records = removeIndex(records, idx)
+	if len(records) == 0 {
+		restate.Clear(ctx, sagaDLQRecordsKey)
+	} else {
+		restate.Set(ctx, sagaDLQRecordsKey, records)
+	}
+
+	ctx.Log().Warn("saga.dlq.discarded", "saga", restate.Key(ctx), "dlq_id", req.ID, "reason", req.Reason)
+	d.recordMetrics(ctx, restate.Key(ctx), "discarded", records)
+	return restate.Void{}, nil
+}
+
+// compensate runs the record's remaining entries one at a time in reverse
+// dependency order. On failure the record keeps only the entries that are
+// still outstanding, with the cursor on the step that failed.
+func (d *SagaDLQ) compensate(ctx restate.ObjectContext, sagaName string, record *SagaDLQRecord) error {
+	done := make([]bool, len(record.Entries))
+	fail := func(idx int, err error) error {
+		record.Entries, record.Cursor = liveSagaEntries(record.Entries, done, idx)
+		return err
+	}
+
+	for _, idx := range compensationOrder(record.Entries, record.Cursor) {
+		entry := record.Entries[idx]
+		if !entry.needsCompensation(record.Strategy) {
+			done[idx] = true
+			continue
+		}
+
+		name := resolveSagaAlias(sagaName, entry.Name)
+		undo, ok := lookupSagaUndo(sagaName, name)
+		if !ok {
+			return fail(idx, fmt.Errorf("no compensation registered for %s/%s (see RegisterSagaCompensation)", sagaName, entry.Name))
+		}
+		payload, err := migrateSagaPayload(lookupSagaSchema(sagaName, name), entry)
+		if err != nil {
+			return fail(idx, err)
+		}
+
+		// Both Runs are journaled whether or not metrics are configured, so
+		// enabling them does not change the journal of running invocations
+		start, err := RunDo(ctx, func(rc restate.RunContext) (time.Time, error) {
+			return time.Now(), nil
+		}, restate.WithName("saga.dlq.compensate_started"))
+		if err != nil {
+			return fail(idx, err)
+		}
+		runErr := undo.run(ctx, entry, payload, sagaIdempotencyKey(record.SagaKey, entry),
+			fmt.Sprintf("saga.dlq.compensate.%s", entry.Name), RetryPolicy{}, entry.Timeout)
+		// Recorded inside a Run so replays do not count the attempt again
+		_ = RunDoVoid(ctx, func(rc restate.RunContext) error {
+			if d.metrics != nil {
+				d.metrics.RecordCompensation(entry.Name, time.Since(start), runErr)
+			}
+			return nil
+		}, restate.WithName("saga.dlq.compensate_metrics"))
+
+		if runErr != nil {
+			record.Entries[idx].Attempt++
+			return fail(idx, fmt.Errorf("compensation %s failed: %w", entry.Name, runErr))
+		}
+		done[idx] = true
+	}
+
+	record.Entries = nil
+	record.Cursor = -1
+	return nil
+}
+
+// recordMetrics emits an event counter and the open-record gauge inside a
+// Run, so replays do not count the event again. The Run is journaled even
+// without metrics, keeping the journal the same either way.
+func (d *SagaDLQ) recordMetrics(ctx restate.ObjectContext, sagaName, event string, records []SagaDLQRecord) {
+	open := 0
+	for _, r := range records {
+		if r.Status == SagaDLQOpen {
+			open++
+		}
+	}
+	_ = RunDoVoid(ctx, func(rc restate.RunContext) error {
+		if d.metrics != nil {
+			d.metrics.RecordDLQEvent(sagaName, event, int64(open))
+		}
+		return nil
+	}, restate.WithName("saga.dlq.metrics."+event))
+}
+
+// findSagaDLQRecord returns the index of the record with the given ID, or -1.
+func findSagaDLQRecord(records []SagaDLQRecord, id string) int {
+	for i, r := range records {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// compensationOrder returns entry indexes in an order that respects the
+// compensation graph, starting with first when it is immediately runnable.
+func compensationOrder(entries []SagaEntry, first int) []int {
+	deps := compensationGraph(entries)
+	dependents := make([]int, len(entries))
+	for _, ds := range deps {
+		for _, d := range ds {
+			dependents[d]++
+		}
+	}
+
+	order := make([]int, 0, len(entries))
+	done := make([]bool, len(entries))
+	for len(order) < len(entries) {
+		next := -1
+		if first >= 0 && first < len(entries) && !done[first] && dependents[first] == 0 {
+			next = first
+		} else {
+			for idx := len(entries) - 1; idx >= 0; idx-- {
+				if !done[idx] && dependents[idx] == 0 {
+					next = idx
+					break
+				}
+			}
+		}
+		if next < 0 {
+			break
+		}
+		done[next] = true
+		order = append(order, next)
+		for _, d := range deps[next] {
+			dependents[d]--
+		}
+	}
+	return order
+}
+
+// -----------------------------------------------------------------------------
+// Section 4B: Saga Timeline
+// -----------------------------------------------------------------------------
+
+// SagaTimelineKind names an event in a saga's timeline.
+type SagaTimelineKind string
+
+const (
+	SagaEventStepAdded             SagaTimelineKind = "step_added"
+	SagaEventCompensationStarted   SagaTimelineKind = "compensation_started"
+	SagaEventCompensationAttempt   SagaTimelineKind = "compensation_attempt"
+	SagaEventCompensationSucceeded SagaTimelineKind = "compensation_succeeded"
+	SagaEventCompensationFailed    SagaTimelineKind = "compensation_failed"
+	SagaEventCompensationSkipped   SagaTimelineKind = "compensation_skipped"
+	SagaEventBackoff               SagaTimelineKind = "backoff"
+	SagaEventDLQEscalated          SagaTimelineKind = "dlq_escalated"
+	SagaEventCompensationCompleted SagaTimelineKind = "compensation_completed"
+	SagaEventChildFolded           SagaTimelineKind = "child_folded"
+	SagaEventEscalated             SagaTimelineKind = "escalated"
+	SagaEventEscalationResolved    SagaTimelineKind = "escalation_resolved"
+	SagaEventDeadlineExceeded      SagaTimelineKind = "deadline_exceeded"
+)
+
+// SagaTimelineEvent is one durable entry in a saga's timeline. Duration is
+// set on attempt outcomes, Delay on backoff events, and Scope on events
+// recorded by a sub-saga created with Child. Outcomes of concurrent
+// compensations carry the time their wave settled, and Duration spans the
+// wave.
+type SagaTimelineEvent struct {
+	Seq      int              `json:"seq"`
+	Kind     SagaTimelineKind `json:"kind"`
+	Scope    string           `json:"scope,omitempty"`
+	Step     string           `json:"step,omitempty"`
+	StepID   string           `json:"step_id,omitempty"`
+	Attempt  int              `json:"attempt,omitempty"`
+	At       time.Time        `json:"at"`
+	Duration time.Duration    `json:"duration_ns,omitempty"`
+	Delay    time.Duration    `json:"delay_ns,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Note     string           `json:"note,omitempty"`
+	DLQID    string           `json:"dlq_id,omitempty"`
+}
+
+// SagaTimeline is the query view of a saga's timeline. RolledBack lists the
+// steps whose compensation succeeded, in the order they were undone.
+type SagaTimeline struct {
+	SagaName    string              `json:"saga_name"`
+	WorkflowKey string              `json:"workflow_key"`
+	Events      []SagaTimelineEvent `json:"events"`
+	RolledBack  []string            `json:"rolled_back"`
+	Escalated   bool                `json:"escalated"`
+}
+
+// GetSagaTimeline reads a saga's timeline from a shared handler, so it can be
+// queried while the workflow is still running; a running compensation adds
+// its events once per wave:
+//
+//	func (w OrderWorkflow) Timeline(ctx restate.WorkflowSharedContext) (framework.SagaTimeline, error) {
+//	    return framework.GetSagaTimeline(ctx, "order")
+//	}
+func GetSagaTimeline(ctx restate.WorkflowSharedContext, sagaName string) (SagaTimeline, error) {
+	key := restate.Key(ctx)
+	events, err := restate.Get[[]SagaTimelineEvent](ctx, sagaTimelineKey(path.Join(key, "saga", sagaName)))
+	if err != nil {
+		return SagaTimeline{}, err
+	}
+
+	timeline := SagaTimeline{
+		SagaName:    sagaName,
+		WorkflowKey: key,
+		Events:      events,
+		RolledBack:  []string{},
+	}
+	for _, e := range events {
+		switch e.Kind {
+		case SagaEventCompensationSucceeded:
+			timeline.RolledBack = append(timeline.RolledBack, e.Step)
+		case SagaEventDLQEscalated:
+			timeline.Escalated = true
+		}
+	}
+	if timeline.Events == nil {
+		timeline.Events = []SagaTimelineEvent{}
+	}
+	return timeline, nil
+}
+
+// sagaTimelineKey is the state key holding the timeline for a saga namespace.
+func sagaTimelineKey(nsKey string) string {
+	return nsKey + ":timeline"
+}
+
+// record appends events to the saga's timeline. During a compensation the
+// events are buffered and written per wave by flushTimeline.
+func (s *SagaFramework) record(events ...SagaTimelineEvent) {
+	s.pendingEvents = append(s.pendingEvents, events...)
+	if !s.batchTimeline {
+		s.flushTimeline()
+	}
+}
+
+// flushTimeline writes the buffered events in one state update, trimming
+// the timeline to TimelineLimit. Events without a time get the last
+// journaled timestamp.
+func (s *SagaFramework) flushTimeline() {
+	if len(s.pendingEvents) == 0 {
+		return
+	}
+	key := s.timelineKey
+	timeline, _ := getSagaState[[]SagaTimelineEvent](s.state, key)
+
+	next := 1
+	if len(timeline) > 0 {
+		next = timeline[len(timeline)-1].Seq + 1
+	}
+	for _, e := range s.pendingEvents {
+		e.Seq = next
+		e.Scope = s.scope
+		if e.At.IsZero() {
+			e.At = s.clock
+		}
+		next++
+		timeline = append(timeline, e)
+	}
+	s.pendingEvents = nil
+
+	if limit := s.cfg.TimelineLimit; limit > 0 && len(timeline) > limit {
+		timeline = timeline[len(timeline)-limit:]
+	}
+	s.state.set(key, timeline)
+}
+
+// now captures wall-clock time durably for timeline timestamps. Each call
+// is a journal entry, so compensation reads it once per wave.
+func (s *SagaFramework) now() time.Time {
+	at, err := RunDo(s.ctx, func(rc restate.RunContext) (time.Time, error) {
+		return time.Now(), nil
+	}, restate.WithName("saga.timeline.clock"))
+	if err != nil {
+		return time.Time{}
+	}
+	s.clock = at
+	return at
+}
+
+// lastNow returns the last journaled timestamp, reading the clock only when
+// this invocation has not journaled one yet.
+func (s *SagaFramework) lastNow() time.Time {
+	if !s.clock.IsZero() {
+		return s.clock
+	}
+	return s.now()
+}
+
+// -----------------------------------------------------------------------------
+// Section 4C: Saga Semantic Locks
+// -----------------------------------------------------------------------------
+
+// SagaLockServiceName is the service name SagaLock is bound under by restate.Reflect.
+const SagaLockServiceName = "SagaLock"
+
+// SagaLease is the lock currently held on a resource.
+type SagaLease struct {
+	Token      string    `json:"token"`
+	Owner      string    `json:"owner"`
+	SagaName   string    `json:"saga_name"`
+	Step       string    `json:"step"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// SagaLockRequest asks SagaLock for a lease. Re-acquiring with the same
+// owner renews the lease.
+type SagaLockRequest struct {
+	Owner    string        `json:"owner"`
+	SagaName string        `json:"saga_name"`
+	Step     string        `json:"step"`
+	Lease    time.Duration `json:"lease"`
+
+	// Service is the name SagaLock is bound under, used to schedule the
+	// lease's expiry. Defaults to SagaLockServiceName.
+	Service string `json:"service,omitempty"`
+}
+
+// SagaLockStatus is the answer to a lock check.
+type SagaLockStatus struct {
+	Resource string     `json:"resource"`
+	Locked   bool       `json:"locked"`
+	Lease    *SagaLease `json:"lease,omitempty"`
+}
+
+// SagaLock is a Virtual Object that holds a semantic lock per resource key.
+// Sagas acquire it through SagaStepOption.Locks; other handlers check it
+// with SagaLockClient before reading data a saga may be about to undo.
+//
+//	server.Bind(restate.Reflect(framework.SagaLock{}))
+type SagaLock struct{}
+
+const sagaLockLeaseKey = "lease"
+
+// Acquire grants or renews a lease, failing with 409 while another owner
+// holds an unexpired one. Expiry is enforced by a delayed Expire call.
+func (SagaLock) Acquire(ctx restate.ObjectContext, req SagaLockRequest) (SagaLease, error) {
+	if req.Owner == "" || req.Lease <= 0 {
+		return SagaLease{}, restate.TerminalError(fmt.Errorf("lock owner and positive lease are required"), 400)
+	}
+
+	now, err := RunDo(ctx, func(rc restate.RunContext) (time.Time, error) {
+		return time.Now(), nil
+	}, restate.WithName("saga.lock.now"))
+	if err != nil {
+		return SagaLease{}, err
+	}
+
+	current, err := restate.Get[*SagaLease](ctx, sagaLockLeaseKey)
+	if err != nil {
+		return SagaLease{}, err
+	}
+	if current != nil && current.Owner != req.Owner && now.Before(current.ExpiresAt) {
+		return SagaLease{}, restate.TerminalError(fmt.Errorf("resource %s is locked by saga %s (step %s) until %s",
+			restate.Key(ctx), current.SagaName, current.Step, current.ExpiresAt.Format(time.RFC3339)), 409)
+	}
+
+	lease := SagaLease{
+		Token:      restate.UUID(ctx).String(),
+		Owner:      req.Owner,
+		SagaName:   req.SagaName,
+		Step:       req.Step,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(req.Lease),
+	}
+	if current != nil && current.Owner == req.Owner {
+		lease.AcquiredAt = current.AcquiredAt
+	}
+	restate.Set(ctx, sagaLockLeaseKey, lease)
+
+	ObjectClient[string, restate.Void]{
+		ServiceName: SagaLockClient{ServiceName: req.Service}.serviceName(),
+		HandlerName: "Expire",
+	}.Send(ctx, restate.Key(ctx), lease.Token, CallOption{Delay: req.Lease})
+
+	ctx.Log().Info("saga.lock.acquired", "resource", restate.Key(ctx), "owner", req.Owner, "expires_at", lease.ExpiresAt)
+	return lease, nil
+}
+
+// Release drops the lease if owner still holds it.
+func (SagaLock) Release(ctx restate.ObjectContext, owner string) (restate.Void, error) {
+	current, err := restate.Get[*SagaLease](ctx, sagaLockLeaseKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	if current == nil || current.Owner != owner {
+		return restate.Void{}, nil
+	}
+	restate.Clear(ctx, sagaLockLeaseKey)
+	ctx.Log().Info("saga.lock.released", "resource", restate.Key(ctx), "owner", owner)
+	return restate.Void{}, nil
+}
+
+// Expire drops the lease once its timeout fires, unless it was renewed or
+// replaced since the timer was scheduled.
+func (SagaLock) Expire(ctx restate.ObjectContext, token string) (restate.Void, error) {
+	current, err := restate.Get[*SagaLease](ctx, sagaLockLeaseKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	if current == nil || current.Token != token {
+		return restate.Void{}, nil
+	}
+	restate.Clear(ctx, sagaLockLeaseKey)
+	_ = HandleGuardrailViolation(GuardrailViolation{
+		Check: "saga_lock_expired",
+		Message: fmt.Sprintf("lease on %s held by saga %s (step %s) expired before it was released; the saga no longer isolates the resource",
+			restate.Key(ctx), current.SagaName, current.Step),
+		Severity: "warning",
+	}, ctx.Log(), PolicyWarn)
+	return restate.Void{}, nil
+}
+
+// Status reports whether the resource is locked.
+func (SagaLock) Status(ctx restate.ObjectSharedContext) (SagaLockStatus, error) {
+	status := SagaLockStatus{Resource: restate.Key(ctx)}
+	current, err := restate.Get[*SagaLease](ctx, sagaLockLeaseKey)
+	if err != nil || current == nil {
+		return status, err
+	}
+
+	now, err := RunDo(ctx, func(rc restate.RunContext) (time.Time, error) {
+		return time.Now(), nil
+	}, restate.WithName("saga.lock.now"))
+	if err != nil {
+		return status, err
+	}
+	status.Locked = now.Before(current.ExpiresAt)
+	if status.Locked {
+		status.Lease = current
+	}
+	return status, nil
+}
+
+// SagaLockClient checks semantic locks from other handlers.
+type SagaLockClient struct {
+	// ServiceName defaults to SagaLockServiceName
+	ServiceName string
+}
+
+// Status returns the lock state of resource.
+func (c SagaLockClient) Status(ctx restate.Context, resource string) (SagaLockStatus, error) {
+	return ObjectClient[restate.Void, SagaLockStatus]{
+		ServiceName: c.serviceName(),
+		HandlerName: "Status",
+	}.Call(ctx, resource, restate.Void{})
+}
+
+// EnsureUnlocked fails with 409 while a saga holds resource.
+func (c SagaLockClient) EnsureUnlocked(ctx restate.Context, resource string) error {
+	status, err := c.Status(ctx, resource)
+	if err != nil {
+		return err
+	}
+	if status.Locked {
+		return restate.TerminalError(fmt.Errorf("resource %s is locked by saga %s", resource, status.Lease.SagaName), 409)
+	}
+	return nil
+}
+
+func (c SagaLockClient) serviceName() string {
+	if c.ServiceName == "" {
+		return SagaLockServiceName
+	}
+	return c.ServiceName
+}
+
+// acquireLock takes resource on behalf of step, blocking until SagaLock answers.
+func (s *SagaFramework) acquireLock(resource, step string) error {
+	lease := s.cfg.LockLease
+	if lease <= 0 {
+		lease = 1 * time.Hour
+	}
+	service := SagaLockClient{ServiceName: s.cfg.LockService}.serviceName()
+	_, err := ObjectClient[SagaLockRequest, SagaLease]{
+		ServiceName: service,
+		HandlerName: "Acquire",
+	}.Call(s.ctx, resource, SagaLockRequest{
+		Owner:    s.lockOwner,
+		SagaName: s.name,
+		Step:     step,
+		Lease:    lease,
+		Service:  service,
+	})
+	if err != nil {
+		s.log.Warn("saga.lock.acquire_failed", "resource", resource, "step", step, "err", err.Error())
+		return err
+	}
+	return nil
+}
+
+// RenewLocks extends the lease of every lock held by the saga's steps by
+// another LockLease. Call it from sagas that may run longer than LockLease;
+// it fails with 409 if a lease already expired and another saga took it.
+func (s *SagaFramework) RenewLocks() error {
+	entries, _ := getSagaState[[]SagaEntry](s.state, s.nsKey)
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		for _, resource := range e.Locks {
+			if seen[resource] {
+				continue
+			}
+			seen[resource] = true
+			if err := s.acquireLock(resource, e.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseResources releases resources unless one of entries, or a step of
+// an enclosing saga sharing the lock owner, still holds it.
+func (s *SagaFramework) releaseResources(entries []SagaEntry, resources []string) {
+	held := make(map[string]bool)
+	for _, e := range entries {
+		for _, resource := range e.Locks {
+			held[resource] = true
+		}
+	}
+	for p := s.parent; p != nil; p = p.parent {
+		outer, _ := getSagaState[[]SagaEntry](p.state, p.nsKey)
+		for _, e := range outer {
+			for _, resource := range e.Locks {
+				held[resource] = true
+			}
+		}
+	}
+	for _, resource := range resources {
+		if held[resource] {
+			continue
+		}
+		held[resource] = true
+		ObjectClient[string, restate.Void]{
+			ServiceName: SagaLockClient{ServiceName: s.cfg.LockService}.serviceName(),
+			HandlerName: "Release",
+		}.Send(s.ctx, resource, s.lockOwner)
+	}
+}
+
+// releaseLocks releases every lock held by entries, which are done with
+// them. A child saga shares its root's lock owner, so locks an enclosing
+// saga's steps still hold are kept.
+func (s *SagaFramework) releaseLocks(entries []SagaEntry) {
+	var resources []string
+	for _, e := range entries {
+		resources = append(resources, e.Locks...)
+	}
+	s.releaseResources(nil, resources)
+}
+
+// -----------------------------------------------------------------------------
+// Section 4D: Declarative Workflow Builder
+// -----------------------------------------------------------------------------
+
+// WorkflowStepOptions declares what a builder step contributes beyond its
+// action: a status label for progress tracking, a saga compensation and a retry
+// policy.
+type WorkflowStepOptions[S any] struct {
+	// Status is the phase reported to the progress tracker while the step runs.
+	// Defaults to the step name.
+	Status string
+
+	// Compensate undoes the step if a later step fails. It receives the
+	// workflow state after the step, or before it when the step never
+	// completed.
+	Compensate func(rc restate.RunContext, result StepResult[S]) error
+
+	// Retry re-runs Step and Run actions on non-terminal errors with durable
+	// backoff. Calls and timers rely on Restate's own retries and ignore it.
+	Retry *RunConfig
+}
+
+type builderStepKind int
+
+const (
+	builderStepSync builderStepKind = iota
+	builderStepRun
+	builderStepAsync
+	builderStepWaitAll
+	builderStepWaitFirst
+)
+
+type builderStep[S any] struct {
+	name     string
+	kind     builderStepKind
+	opts     WorkflowStepOptions[S]
+	sync     func(ctx restate.WorkflowContext, st *S) error
+	run      func(rc restate.RunContext, st S) (S, error)
+	start    func(ctx restate.WorkflowContext, st S) (restate.Future, error)
+	complete func(st *S, fut restate.Future) error
+	waitOn   []string
+}
+
+// WorkflowBuilder assembles a workflow over a typed state S from steps,
+// async calls, timers and joins, then compiles it into a
+// restate.WorkflowContext handler. Every step reports progress through
+// a ProgressTracker and can declare a compensation; a failing step rolls back
+// the completed ones through the saga framework.
+//
+//	b := framework.NewWorkflowBuilder[Order]("checkout").
+//	    Run("charge", charge, framework.WorkflowStepOptions[Order]{
+//	        Status:     "charging card",
+//	        Compensate: refund,
+//	        Retry:      &framework.RunConfig{MaxRetries: 3, InitialDelay: time.Second},
+//	    })
+//	framework.ServiceCall(b, "reserve", inventoryClient, reserveInput, applyReservation).
+//	    WaitAll("reserved").
+//	    Sleep("cool_off", time.Minute)
+//	checkout := b.Build()
+//
+//	func (CheckoutWorkflow) Run(ctx restate.WorkflowContext, o Order) (Order, error) {
+//	    return checkout(ctx, o)
+//	}
+type WorkflowBuilder[S any] struct {
+	name      string
+	steps     []builderStep[S]
+	sagaCfg   *SagaConfig
+	statusKey string
+	wfCfg     WorkflowConfig
+}
+
+// NewWorkflowBuilder starts a workflow definition over state S.
+func NewWorkflowBuilder[S any](name string) *WorkflowBuilder[S] {
+	return &WorkflowBuilder[S]{name: name, statusKey: "workflow_status", wfCfg: DefaultWorkflowConfig()}
+}
+
+// WithWorkflowConfig sets the configuration progress tracking follows, such
+// as status persistence and history length.
+func (b *WorkflowBuilder[S]) WithWorkflowConfig(cfg WorkflowConfig) *WorkflowBuilder[S] {
+	b.wfCfg = cfg
+	return b
+}
+
+// WithSagaConfig sets the saga configuration used for compensations.
+func (b *WorkflowBuilder[S]) WithSagaConfig(cfg *SagaConfig) *WorkflowBuilder[S] {
+	b.sagaCfg = cfg
+	return b
+}
+
+// WithStatusKey changes the state key progress is written to. It is ignored
+// when the handler already called TrackProgress.
+func (b *WorkflowBuilder[S]) WithStatusKey(key string) *WorkflowBuilder[S] {
+	b.statusKey = key
+	return b
+}
+
+// Step adds a synchronous step with full access to the workflow context.
+func (b *WorkflowBuilder[S]) Step(name string, fn func(ctx restate.WorkflowContext, st *S) error, opts ...WorkflowStepOptions[S]) *WorkflowBuilder[S] {
+	return b.add(builderStep[S]{name: name, kind: builderStepSync, sync: fn}, opts)
+}
+
+// Run adds a side effect executed inside restate.Run. It returns the new
+// state, which is journaled so replays see the same value.
+func (b *WorkflowBuilder[S]) Run(name string, fn func(rc restate.RunContext, st S) (S, error), opts ...WorkflowStepOptions[S]) *WorkflowBuilder[S] {
+	return b.add(builderStep[S]{name: name, kind: builderStepRun, run: fn}, opts)
+}
+
+// Async starts a future without waiting for it. complete applies its result
+// to the state when a later WaitAll or WaitFirst, or the end of the
+// workflow, collects it.
+func (b *WorkflowBuilder[S]) Async(
+	name string,
+	start func(ctx restate.WorkflowContext, st S) (restate.Future, error),
+	complete func(st *S, fut restate.Future) error,
+	opts ...WorkflowStepOptions[S],
+) *WorkflowBuilder[S] {
+	return b.add(builderStep[S]{name: name, kind: builderStepAsync, start: start, complete: complete}, opts)
+}
+
+// Sleep adds a durable timer.
+func (b *WorkflowBuilder[S]) Sleep(name string, d time.Duration, opts ...WorkflowStepOptions[S]) *WorkflowBuilder[S] {
+	return b.Step(name, func(ctx restate.WorkflowContext, _ *S) error {
+		return restate.Sleep(ctx, d)
+	}, opts...)
+}
+
+// WaitAll collects the named async steps, or every outstanding one when no
+// names are given.
+func (b *WorkflowBuilder[S]) WaitAll(name string, steps ...string) *WorkflowBuilder[S] {
+	return b.add(builderStep[S]{name: name, kind: builderStepWaitAll, waitOn: steps}, nil)
+}
+
+// WaitFirst collects whichever of the named async steps finishes first; the
+// others stay outstanding.
+func (b *WorkflowBuilder[S]) WaitFirst(name string, steps ...string) *WorkflowBuilder[S] {
+	return b.add(builderStep[S]{name: name, kind: builderStepWaitFirst, waitOn: steps}, nil)
+}
+
+// ServiceCall adds an async call to a service handler. input builds the
+// request from the state and output folds the response back into it.
+func ServiceCall[S, I, O any](b *WorkflowBuilder[S], name string, client ServiceClient[I, O],
+	input func(st S) I, output func(st *S, out O), opts ...WorkflowStepOptions[S]) *WorkflowBuilder[S] {
+	return b.Async(name, func(ctx restate.WorkflowContext, st S) (restate.Future, error) {
+		return restate.Service[O](ctx, client.ServiceName, client.HandlerName).RequestFuture(input(st)), nil
+	}, responseInto(output), opts...)
+}
+
+// ObjectCall adds an async call to a Virtual Object handler keyed from the state.
+func ObjectCall[S, I, O any](b *WorkflowBuilder[S], name string, client ObjectClient[I, O], key func(st S) string,
+	input func(st S) I, output func(st *S, out O), opts ...WorkflowStepOptions[S]) *WorkflowBuilder[S] {
+	return b.Async(name, func(ctx restate.WorkflowContext, st S) (restate.Future, error) {
+		return restate.Object[O](ctx, client.ServiceName, key(st), client.HandlerName).RequestFuture(input(st)), nil
+	}, responseInto(output), opts...)
+}
+
+// responseInto reads a call response and applies it to the state.
+func responseInto[S, O any](output func(st *S, out O)) func(st *S, fut restate.Future) error {
+	return func(st *S, fut restate.Future) error {
+		resp, ok := fut.(restate.ResponseFuture[O])
+		if !ok {
+			return restate.TerminalError(fmt.Errorf("unexpected future type %T", fut), 500)
+		}
+		out, err := resp.Response()
+		if err != nil {
+			return err
+		}
+		if output != nil {
+			output(st, out)
+		}
+		return nil
+	}
+}
+
+func (b *WorkflowBuilder[S]) add(step builderStep[S], opts []WorkflowStepOptions[S]) *WorkflowBuilder[S] {
+	if len(opts) > 0 {
+		step.opts = opts[len(opts)-1]
+	}
+	b.steps = append(b.steps, step)
+	return b
+}
+
+// Build compiles the definition into a workflow handler that returns the
+// final state.
+func (b *WorkflowBuilder[S]) Build() func(ctx restate.WorkflowContext, input S) (S, error) {
+	steps := append([]builderStep[S](nil), b.steps...)
+	return func(ctx restate.WorkflowContext, input S) (S, error) {
+		return b.execute(ctx, steps, input)
+	}
+}
+
+// CompileWorkflow compiles a definition into a handler with a distinct output type.
+func CompileWorkflow[S, O any](b *WorkflowBuilder[S], output func(st S) (O, error)) func(ctx restate.WorkflowContext, input S) (O, error) {
+	run := b.Build()
+	return func(ctx restate.WorkflowContext, input S) (O, error) {
+		st, err := run(ctx, input)
+		if err != nil {
+			var zero O
+			return zero, err
+		}
+		return output(st)
+	}
+}
+
+// builderAsync is an async step whose future has not been collected yet.
+type builderAsync[S any] struct {
+	step builderStep[S]
+	fut  restate.Future
+}
+
+func (b *WorkflowBuilder[S]) execute(ctx restate.WorkflowContext, steps []builderStep[S], input S) (st S, err error) {
+	st = input
+	log := ctx.Log().With("workflow", b.name)
+
+	tracker, owned := ensureProgress(ctx, b.statusKey, b.wfCfg)
+	if owned {
+		// Registered first so it runs last, after compensation has settled
+		defer tracker.Finish(&err)
+		tracker.ExpectSteps(len(steps))
+	}
+	tracker.Annotate("workflow", b.name)
+
+	saga := NewSaga(ctx, b.name, b.sagaCfg)
+	defer saga.CompensateIfNeeded(&err)
+	for _, step := range steps {
+		if step.opts.Compensate != nil {
+			RegisterTyped(saga, step.name, 0, step.opts.Compensate)
+		}
+	}
+
+	var outstanding []builderAsync[S]
+	collect := func(a builderAsync[S]) error {
+		if err := a.step.complete(&st, a.fut); err != nil {
+			return fmt.Errorf("step %s failed: %w", a.step.name, err)
+		}
+		return b.finishStep(saga, tracker, a.step, st)
+	}
+
+	for i, step := range steps {
+		tracker.StepStarted(step.name, step.opts.Status)
+		log.Info("workflow.step.starting", "step", step.name, "index", i)
+
+		if step.opts.Compensate != nil {
+			if err := saga.Add(step.name, StepResult[S]{Value: st}, false); err != nil {
+				return st, err
+			}
+		}
+
+		switch step.kind {
+		case builderStepSync:
+			if err := b.retry(ctx, step, func() error { return step.sync(ctx, &st) }); err != nil {
+				return st, fmt.Errorf("step %s failed: %w", step.name, err)
+			}
+		case builderStepRun:
+			cfg := DefaultRunConfig(step.name)
+			cfg.MaxRetries = 0
+			if step.opts.Retry != nil {
+				cfg = *step.opts.Retry
+				if cfg.Name == "" {
+					cfg.Name = step.name
+				}
+			}
+			current := st
+			next, err := RunWithRetry(ctx, cfg, func(rc restate.RunContext) (S, error) {
+				return step.run(rc, current)
+			})
+			if err != nil {
+				return st, fmt.Errorf("step %s failed: %w", step.name, err)
+			}
+			st = next
+		case builderStepAsync:
+			fut, err := step.start(ctx, st)
+			if err != nil {
+				return st, fmt.Errorf("step %s failed: %w", step.name, err)
+			}
+			outstanding = append(outstanding, builderAsync[S]{step: step, fut: fut})
+			continue
+		case builderStepWaitAll, builderStepWaitFirst:
+			var selected []builderAsync[S]
+			selected, outstanding = selectBuilderAsync(outstanding, step.waitOn)
+			if len(selected) == 0 {
+				break
+			}
+			futs := make([]restate.Future, len(selected))
+			for n, a := range selected {
+				futs[n] = a.fut
+			}
+
+			if step.kind == builderStepWaitFirst {
+				winner, err := restate.WaitFirst(ctx, futs...)
+				if err != nil {
+					return st, fmt.Errorf("step %s failed: %w", step.name, err)
+				}
+				n := futureIndex(futs, winner)
+				if err := collect(selected[n]); err != nil {
+					return st, err
+				}
+				outstanding = append(outstanding, removeIndex(selected, n)...)
+				break
+			}
+
+			for fut, err := range restate.Wait(ctx, futs...) {
+				if err != nil {
+					return st, fmt.Errorf("step %s failed: %w", step.name, err)
+				}
+				if err := collect(selected[futureIndex(futs, fut)]); err != nil {
+					return st, err
+				}
+			}
+		}
+
+		if err := b.finishStep(saga, tracker, step, st); err != nil {
+			return st, err
+		}
+	}
+
+	// Async steps nobody joined explicitly are collected before completing
+	for _, a := range outstanding {
+		if err := collect(a); err != nil {
+			return st, err
+		}
+	}
+
+	log.Info("workflow.completed", "steps", len(steps))
+	return st, nil
+}
+
+// finishStep marks a compensable step completed with the state it produced
+// and reports it to the progress tracker.
+func (b *WorkflowBuilder[S]) finishStep(saga *SagaFramework, tracker *ProgressTracker, step builderStep[S], st S) error {
+	if step.opts.Compensate != nil {
+		raw, err := canonicalJSON(StepResult[S]{Value: st, Completed: true})
+		if err != nil {
+			return fmt.Errorf("saga: marshal step result: %w", err)
+		}
+		if err := saga.markStep(step.name, SagaStepCompleted, raw); err != nil {
+			return err
+		}
+	}
+	tracker.StepCompleted(step.name)
+	return nil
+}
+
+// retry runs a synchronous step under its retry policy, sleeping durably
+// between attempts. Errors the policy does not retry, terminal ones by
+// default, are returned immediately.
+func (b *WorkflowBuilder[S]) retry(ctx restate.WorkflowContext, step builderStep[S], body func() error) error {
+	cfg := step.opts.Retry
+	if cfg == nil {
+		return body()
+	}
+	attempts, exhausted, err := retryWithPolicy(ctx, cfg.policy(), "workflow.step."+step.name, func(int) error {
+		return body()
+	})
+	if err == nil || !exhausted {
+		return err
+	}
+	return restate.TerminalError(fmt.Errorf("retry exhausted after %d attempts: %w", attempts, err), 500)
+}
+
+// selectBuilderAsync splits outstanding async steps into those named (all
+// when names is empty) and the rest.
+func selectBuilderAsync[S any](outstanding []builderAsync[S], names []string) (selected, rest []builderAsync[S]) {
+	if len(names) == 0 {
+		return outstanding, nil
+	}
+	for _, a := range outstanding {
+		matched := false
+		for _, name := range names {
+			if name == a.step.name {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			selected = append(selected, a)
+		} else {
+			rest = append(rest, a)
+		}
+	}
+	return selected, rest
+}
+
+// -----------------------------------------------------------------------------
+// Section 4E: Workflow Specs
+// -----------------------------------------------------------------------------
+
+// WorkflowSpecRegistryName is the service name WorkflowSpecRegistry is bound
+// under by restate.Reflect.
+const WorkflowSpecRegistryName = "WorkflowSpecRegistry"
+
+// WorkflowVars is the working state of a spec-driven workflow. Activities
+// receive it and return the variables they want to add or overwrite.
+type WorkflowVars map[string]any
+
+// WorkflowActivity is a Go function a spec can refer to by name. It runs
+// inside restate.Run, so its result is journaled.
+type WorkflowActivity func(rc restate.RunContext, vars WorkflowVars) (WorkflowVars, error)
+
+var (
+	workflowActivitiesMu sync.RWMutex
+	workflowActivities   = make(map[string]WorkflowActivity)
+)
+
+// RegisterWorkflowActivity makes an activity available to workflow specs,
+// both as a step action and as a compensation. Call it at init time in every
+// process that runs SpecWorkflow.
+func RegisterWorkflowActivity(name string, fn WorkflowActivity) {
+	if fn == nil {
+		slog.Warn("workflow_spec.register: nil activity ignored", "activity", name)
+		return
+	}
+	workflowActivitiesMu.Lock()
+	defer workflowActivitiesMu.Unlock()
+	workflowActivities[name] = fn
+}
+
+func lookupWorkflowActivity(name string) (WorkflowActivity, bool) {
+	workflowActivitiesMu.RLock()
+	defer workflowActivitiesMu.RUnlock()
+	fn, ok := workflowActivities[name]
+	return fn, ok
+}
+
+// WorkflowSpecStepType selects what a spec step does.
+type WorkflowSpecStepType string
+
+const (
+	// WorkflowSpecActivity runs a registered activity
+	WorkflowSpecActivity WorkflowSpecStepType = "activity"
+
+	// WorkflowSpecBranch runs Then or Else depending on If
+	WorkflowSpecBranch WorkflowSpecStepType = "branch"
+
+	// WorkflowSpecSleep waits for Duration on a durable timer
+	WorkflowSpecSleep WorkflowSpecStepType = "sleep"
+
+	// WorkflowSpecApproval waits for a decision sent through SpecWorkflow.Approve
+	WorkflowSpecApproval WorkflowSpecStepType = "approval"
+)
+
+// WorkflowSpec is a workflow definition loaded from YAML or JSON.
+//
+//	name: refund
+//	steps:
+//	  - name: charge
+//	    activity: payments.charge
+//	    compensate: payments.refund
+//	    timeout: 30s
+//	    retry: {max_attempts: 3, initial_delay: 2s}
+//	  - name: review
+//	    type: branch
+//	    if: amount > 1000
+//	    then:
+//	      - {name: manager, type: approval, timeout: 48h}
+//	  - {name: settle_delay, type: sleep, duration: 1h}
+//	  - {name: ship, activity: shipping.create, status: shipping}
+type WorkflowSpec struct {
+	Name    string             `json:"name" yaml:"name"`
+	Version string             `json:"version,omitempty" yaml:"version,omitempty"`
+	Steps   []WorkflowSpecStep `json:"steps" yaml:"steps"`
+}
+
+// WorkflowSpecStep is one step of a spec. Type defaults to activity when
+// Activity is set. Step names must be unique across the whole spec; they
+// name saga steps and approval promises.
+type WorkflowSpecStep struct {
+	Name   string               `json:"name" yaml:"name"`
+	Type   WorkflowSpecStepType `json:"type,omitempty" yaml:"type,omitempty"`
+	Status string               `json:"status,omitempty" yaml:"status,omitempty"`
+
+	// Activity steps
+	Activity   string             `json:"activity,omitempty" yaml:"activity,omitempty"`
+	Input      map[string]any     `json:"input,omitempty" yaml:"input,omitempty"`
+	Compensate string             `json:"compensate,omitempty" yaml:"compensate,omitempty"`
+	Retry      *WorkflowSpecRetry `json:"retry,omitempty" yaml:"retry,omitempty"`
+
+	// Approval steps: Timeout bounds the wait for a decision. Activities run
+	// in restate.Run, which cannot be abandoned without a second copy
+	// running next to it, so they take no timeout.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Sleep steps
+	Duration string `json:"duration,omitempty" yaml:"duration,omitempty"`
+
+	// Branch steps. If is a variable name, optionally negated with "!", or
+	// a comparison "var op literal" with op one of == != > >= < <=.
+	If   string             `json:"if,omitempty" yaml:"if,omitempty"`
+	Then []WorkflowSpecStep `json:"then,omitempty" yaml:"then,omitempty"`
+	Else []WorkflowSpecStep `json:"else,omitempty" yaml:"else,omitempty"`
+
+	// Approval steps: "approve" or "reject" (default) when Timeout elapses
+	OnTimeout string `json:"on_timeout,omitempty" yaml:"on_timeout,omitempty"`
+}
+
+// WorkflowSpecRetry retries an activity on non-terminal errors.
+// It maps onto a RetryPolicy; every failed attempt is journaled and counts
+// against max_attempts, and max_attempts 0 with max_elapsed set retries
+// until the time budget runs out.
+type WorkflowSpecRetry struct {
+	MaxAttempts  int     `json:"max_attempts" yaml:"max_attempts"`
+	InitialDelay string  `json:"initial_delay,omitempty" yaml:"initial_delay,omitempty"`
+	MaxDelay     string  `json:"max_delay,omitempty" yaml:"max_delay,omitempty"`
+	MaxElapsed   string  `json:"max_elapsed,omitempty" yaml:"max_elapsed,omitempty"`
+	Jitter       float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+}
+
+// policy converts the validated retry block into a RetryPolicy.
+func (r *WorkflowSpecRetry) policy() RetryPolicy {
+	if r == nil {
+		return RetryPolicy{MaxAttempts: 1}
+	}
+	initial, _ := parseSpecDuration(r.InitialDelay)
+	maxDelay, _ := parseSpecDuration(r.MaxDelay)
+	maxElapsed, _ := parseSpecDuration(r.MaxElapsed)
+	attempts := r.MaxAttempts
+	if attempts < 1 && maxElapsed <= 0 {
+		attempts = 1
+	}
+	return RetryPolicy{
+		MaxAttempts:  attempts,
+		InitialDelay: initial,
+		MaxDelay:     maxDelay,
+		MaxElapsed:   maxElapsed,
+		Jitter:       r.Jitter,
+	}
+}
+
+// ParseWorkflowSpec decodes a spec from JSON or YAML, detected from the
+// first non-blank character, and validates it.
+func ParseWorkflowSpec(data []byte) (*WorkflowSpec, error) {
+	var spec WorkflowSpec
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal([]byte(trimmed), &spec); err != nil {
+			return nil, fmt.Errorf("workflow spec: decode json: %w", err)
+		}
+	} else if err := yaml.Unmarshal([]byte(trimmed), &spec); err != nil {
+		return nil, fmt.Errorf("workflow spec: decode yaml: %w", err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Validate checks the structure of a spec. Activity names are checked
+// against the registry when the spec runs, since the process publishing a
+// spec need not host its activities.
+func (spec *WorkflowSpec) Validate() error {
+	if spec.Name == "" {
+		return fmt.Errorf("workflow spec: name is required")
+	}
+	if len(spec.Steps) == 0 {
+		return fmt.Errorf("workflow spec %s: no steps", spec.Name)
+	}
+	seen := make(map[string]bool)
+	var errs []error
+	walkWorkflowSpec(spec.Steps, func(step *WorkflowSpecStep) {
+		if err := step.validate(seen); err != nil {
+			errs = append(errs, fmt.Errorf("workflow spec %s: %w", spec.Name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+func (step *WorkflowSpecStep) validate(seen map[string]bool) error {
+	if step.Name == "" {
+		return fmt.Errorf("step without a name")
+	}
+	if seen[step.Name] {
+		return fmt.Errorf("duplicate step name %q", step.Name)
+	}
+	seen[step.Name] = true
+
+	durations := map[string]string{"timeout": step.Timeout, "duration": step.Duration}
+	if step.Retry != nil {
+		durations["retry.initial_delay"] = step.Retry.InitialDelay
+		durations["retry.max_delay"] = step.Retry.MaxDelay
+		durations["retry.max_elapsed"] = step.Retry.MaxElapsed
+		if step.Retry.Jitter < 0 || step.Retry.Jitter > 1 {
+			return fmt.Errorf("step %s: retry.jitter must be between 0 and 1", step.Name)
+		}
+	}
+	for field, value := range durations {
+		if _, err := parseSpecDuration(value); err != nil {
+			return fmt.Errorf("step %s: %s: %w", step.Name, field, err)
+		}
+	}
+
+	switch step.kind() {
+	case WorkflowSpecActivity:
+		if step.Activity == "" {
+			return fmt.Errorf("step %s: activity is required", step.Name)
+		}
+		if step.Timeout != "" {
+			return fmt.Errorf("step %s: activities do not support timeout", step.Name)
+		}
+	case WorkflowSpecBranch:
+		if _, err := parseSpecCondition(step.If); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+	case WorkflowSpecSleep:
+		if step.Duration == "" {
+			return fmt.Errorf("step %s: duration is required", step.Name)
+		}
+	case WorkflowSpecApproval:
+		if step.OnTimeout != "" && step.OnTimeout != "approve" && step.OnTimeout != "reject" {
+			return fmt.Errorf("step %s: on_timeout must be approve or reject", step.Name)
+		}
+	default:
+		return fmt.Errorf("step %s: unknown type %q", step.Name, step.Type)
+	}
+	return nil
+}
+
+func (step *WorkflowSpecStep) kind() WorkflowSpecStepType {
+	if step.Type == "" && step.Activity != "" {
+		return WorkflowSpecActivity
+	}
+	return step.Type
+}
+
+// Activities lists the activity names a spec refers to, including compensations.
+func (spec *WorkflowSpec) Activities() []string {
+	var names []string
+	walkWorkflowSpec(spec.Steps, func(step *WorkflowSpecStep) {
+		if step.Activity != "" {
+			names = append(names, step.Activity)
+		}
+		if step.Compensate != "" {
+			names = append(names, step.Compensate)
+		}
+	})
+	return dedupeStrings(names)
+}
+
+func (spec *WorkflowSpec) unknownActivities() []string {
+	var missing []string
+	for _, name := range spec.Activities() {
+		if _, ok := lookupWorkflowActivity(name); !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+func walkWorkflowSpec(steps []WorkflowSpecStep, visit func(step *WorkflowSpecStep)) {
+	for i := range steps {
+		visit(&steps[i])
+		walkWorkflowSpec(steps[i].Then, visit)
+		walkWorkflowSpec(steps[i].Else, visit)
+	}
+}
+
+func parseSpecDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %s", value)
+	}
+	return d, nil
+}
+
+// specCondition is a parsed branch condition.
+type specCondition struct {
+	variable string
+	negate   bool
+	op       string
+	literal  any
+}
+
+func parseSpecCondition(expr string) (specCondition, error) {
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 1:
+		name := strings.TrimPrefix(fields[0], "!")
+		if name == "" {
+			return specCondition{}, fmt.Errorf("empty condition variable")
+		}
+		return specCondition{variable: name, negate: name != fields[0]}, nil
+	case 3:
+		switch fields[1] {
+		case "==", "!=", ">", ">=", "<", "<=":
+		default:
+			return specCondition{}, fmt.Errorf("unknown operator %q in condition %q", fields[1], expr)
+		}
+		return specCondition{variable: fields[0], op: fields[1], literal: parseSpecLiteral(fields[2])}, nil
+	default:
+		return specCondition{}, fmt.Errorf("condition %q must be \"var\", \"!var\" or \"var op literal\"", expr)
+	}
+}
+
+func parseSpecLiteral(raw string) any {
+	if unquoted, err := strconv.Unquote(raw); err == nil {
+		return unquoted
+	}
+	if b, err := strconv.ParseBool(raw); err == nil {
+		return b
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f
+	}
+	return raw
+}
+
+func (c specCondition) eval(vars WorkflowVars) bool {
+	value, ok := vars[c.variable]
+	if c.op == "" {
+		return specTruthy(value, ok) != c.negate
+	}
+
+	if lf, lok := specNumber(value); lok {
+		if rf, rok := specNumber(c.literal); rok {
+			switch c.op {
+			case "==":
+				return lf == rf
+			case "!=":
+				return lf != rf
+			case ">":
+				return lf > rf
+			case ">=":
+				return lf >= rf
+			case "<":
+				return lf < rf
+			case "<=":
+				return lf <= rf
+			}
+		}
+	}
+
+	// Non-numeric values only support equality, compared as text
+	equal := ok && fmt.Sprint(value) == fmt.Sprint(c.literal)
+	switch c.op {
+	case "==":
+		return equal
+	case "!=":
+		return !equal
+	}
+	return false
+}
+
+func specTruthy(value any, ok bool) bool {
+	if !ok || value == nil {
+		return false
+	}
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	}
+	if f, isNum := specNumber(value); isNum {
+		return f != 0
+	}
+	return true
+}
+
+func specNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// WorkflowSpecRegistry is a Virtual Object, keyed by spec name, holding every
+// published version of a spec. Versions are immutable: editing a spec means
+// publishing a new version, and running workflows keep the one they started with.
+//
+//	server.Bind(restate.Reflect(framework.WorkflowSpecRegistry{}))
+type WorkflowSpecRegistry struct{}
+
+// WorkflowSpecSource is a spec document submitted for publication.
+type WorkflowSpecSource struct {
+	// Source is the YAML or JSON document
+	Source string `json:"source"`
+
+	// Version overrides the version in the document. When both are empty the
+	// next "vN" is assigned.
+	Version string `json:"version,omitempty"`
+}
+
+const (
+	workflowSpecVersionsKey = "versions"
+	workflowSpecLatestKey   = "latest"
+)
+
+func workflowSpecVersionKey(version string) string {
+	return "spec:" + version
+}
+
+// Publish parses, validates and stores a new spec version and makes it the
+// latest. Republishing an existing version with different content fails with 409.
+func (WorkflowSpecRegistry) Publish(ctx restate.ObjectContext, req WorkflowSpecSource) (WorkflowSpec, error) {
+	spec, err := ParseWorkflowSpec([]byte(req.Source))
+	if err != nil {
+		return WorkflowSpec{}, restate.TerminalError(err, 400)
+	}
+	if spec.Name != restate.Key(ctx) {
+		return WorkflowSpec{}, restate.TerminalError(
+			fmt.Errorf("spec name %q does not match registry key %q", spec.Name, restate.Key(ctx)), 400)
+	}
+
+	versions, err := restate.Get[[]string](ctx, workflowSpecVersionsKey)
+	if err != nil {
+		return WorkflowSpec{}, err
+	}
+	if req.Version != "" {
+		spec.Version = req.Version
+	}
+	if spec.Version == "" {
+		spec.Version = fmt.Sprintf("v%d", len(versions)+1)
+	}
+
+	existing, err := restate.Get[*WorkflowSpec](ctx, workflowSpecVersionKey(spec.Version))
+	if err != nil {
+		return WorkflowSpec{}, err
+	}
+	if existing != nil {
+		before, err := canonicalJSON(existing)
+		if err != nil {
+			return WorkflowSpec{}, err
+		}
+		after, err := canonicalJSON(spec)
+		if err != nil {
+			return WorkflowSpec{}, err
+		}
+		if string(before) != string(after) {
+			return WorkflowSpec{}, restate.TerminalError(
+				fmt.Errorf("spec %s version %s already published with different content", spec.Name, spec.Version), 409)
+		}
+		return *existing, nil
+	}
+
+	if missing := spec.unknownActivities(); len(missing) > 0 {
+		ctx.Log().Warn("workflow_spec.unknown_activities", "spec", spec.Name, "version", spec.Version, "activities", missing)
+	}
+
+	restate.Set(ctx, workflowSpecVersionKey(spec.Version), *spec)
+	restate.Set(ctx, workflowSpecVersionsKey, append(versions, spec.Version))
+	restate.Set(ctx, workflowSpecLatestKey, spec.Version)
+	ctx.Log().Info("workflow_spec.published", "spec", spec.Name, "version", spec.Version)
+	return *spec, nil
+}
+
+// Promote makes an already published version the latest, e.g. to roll back a bad edit.
+func (WorkflowSpecRegistry) Promote(ctx restate.ObjectContext, version string) error {
+	existing, err := restate.Get[*WorkflowSpec](ctx, workflowSpecVersionKey(version))
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return restate.TerminalError(fmt.Errorf("spec %s has no version %s", restate.Key(ctx), version), 404)
+	}
+	restate.Set(ctx, workflowSpecLatestKey, version)
+	return nil
+}
+
+// Get returns a spec version, or the latest when version is empty.
+func (WorkflowSpecRegistry) Get(ctx restate.ObjectSharedContext, version string) (WorkflowSpec, error) {
+	if version == "" {
+		latest, err := restate.Get[string](ctx, workflowSpecLatestKey)
+		if err != nil {
+			return WorkflowSpec{}, err
+		}
+		version = latest
+	}
+	spec, err := restate.Get[*WorkflowSpec](ctx, workflowSpecVersionKey(version))
+	if err != nil {
+		return WorkflowSpec{}, err
+	}
+	if spec == nil {
+		return WorkflowSpec{}, restate.TerminalError(fmt.Errorf("spec %s version %q not found", restate.Key(ctx), version), 404)
+	}
+	return *spec, nil
+}
+
+// Versions lists published versions in publication order.
+func (WorkflowSpecRegistry) Versions(ctx restate.ObjectSharedContext) ([]string, error) {
+	return restate.Get[[]string](ctx, workflowSpecVersionsKey)
+}
+
+// SpecWorkflow runs any published spec. The spec version is resolved once
+// when the workflow starts and pinned in its state, so publishing a new
+// version only affects workflows started afterwards.
+//
+//	server.Bind(restate.Reflect(framework.SpecWorkflow{}))
+type SpecWorkflow struct{}
+
+// WorkflowSpecRun starts a spec-driven workflow.
+type WorkflowSpecRun struct {
+	Spec    string       `json:"spec"`
+	Version string       `json:"version,omitempty"` // empty means latest at start
+	Vars    WorkflowVars `json:"vars,omitempty"`
+}
+
+// WorkflowSpecDecision answers an approval step.
+type WorkflowSpecDecision struct {
+	Step     string `json:"step"`
+	Approved bool   `json:"approved"`
+	By       string `json:"by,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+const workflowSpecPinnedKey = "workflow_spec"
+
+// Run resolves the spec from WorkflowSpecRegistry, pins it and interprets it.
+func (SpecWorkflow) Run(ctx restate.WorkflowContext, req WorkflowSpecRun) (WorkflowVars, error) {
+	spec, err := restate.Object[WorkflowSpec](ctx, WorkflowSpecRegistryName, req.Spec, "Get").Request(req.Version)
+	if err != nil {
+		return nil, err
+	}
+	restate.Set(ctx, workflowSpecPinnedKey, spec)
+	ctx.Log().Info("workflow_spec.pinned", "spec", spec.Name, "version", spec.Version)
+	return ExecuteWorkflowSpec(ctx, &spec, req.Vars)
+}
+
+// Spec returns the spec version this workflow is pinned to.
+func (SpecWorkflow) Spec(ctx restate.WorkflowSharedContext) (WorkflowSpec, error) {
+	spec, err := restate.Get[*WorkflowSpec](ctx, workflowSpecPinnedKey)
+	if err != nil {
+		return WorkflowSpec{}, err
+	}
+	if spec == nil {
+		return WorkflowSpec{}, restate.TerminalError(fmt.Errorf("workflow has not started"), 404)
+	}
+	return *spec, nil
+}
+
+// Approve resolves an approval step.
+func (SpecWorkflow) Approve(ctx restate.WorkflowSharedContext, decision WorkflowSpecDecision) error {
+	return ResolveWorkflowSpecApproval(ctx, decision)
+}
+
+// ResolveWorkflowSpecApproval resolves an approval step of a spec-driven
+// workflow. Use it from the shared handlers of custom workflows that call
+// ExecuteWorkflowSpec directly.
+func ResolveWorkflowSpecApproval(ctx restate.WorkflowSharedContext, decision WorkflowSpecDecision) error {
+	if decision.Step == "" {
+		return restate.TerminalError(fmt.Errorf("approval step is required"), 400)
+	}
+	return restate.Promise[WorkflowSpecDecision](ctx, workflowSpecPromiseName(decision.Step)).Resolve(decision)
+}
+
+func workflowSpecPromiseName(step string) string {
+	return "approval:" + step
+}
+
+// ExecuteWorkflowSpec interprets a spec inside a workflow handler. Failed
+// steps roll back completed steps through their compensate activities, and
+// progress is reported through the invocation's ProgressTracker, started on
+// the "workflow_status" key if the handler has none.
+func ExecuteWorkflowSpec(ctx restate.WorkflowContext, spec *WorkflowSpec, vars WorkflowVars) (out WorkflowVars, err error) {
+	if err := spec.Validate(); err != nil {
+		return nil, restate.TerminalError(err, 400)
+	}
+	if missing := spec.unknownActivities(); len(missing) > 0 {
+		return nil, restate.TerminalError(fmt.Errorf("workflow spec %s: unregistered activities %v", spec.Name, missing), 500)
+	}
+	if vars == nil {
+		vars = WorkflowVars{}
+	}
+
+	in := &specInterpreter{ctx: ctx, spec: spec, vars: vars}
+	tracker, owned := ensureProgress(ctx, "", DefaultWorkflowConfig())
+	if owned {
+		// Registered first so it runs last, after compensation has settled
+		defer tracker.Finish(&err)
+		// Branch steps add their chosen branch once it is known
+		in.expected = len(spec.Steps)
+		tracker.ExpectSteps(in.expected)
+	}
+	tracker.Annotate("spec", spec.Name)
+	tracker.Annotate("version", spec.Version)
+	in.tracker = tracker
+
+	in.saga = NewSaga(ctx, "spec:"+spec.Name, nil)
+	defer in.saga.CompensateIfNeeded(&err)
+	walkWorkflowSpec(spec.Steps, func(step *WorkflowSpecStep) {
+		if step.Compensate == "" {
+			return
+		}
+		undo, _ := lookupWorkflowActivity(step.Compensate)
+		RegisterTyped(in.saga, step.Name, 0, func(rc restate.RunContext, vars WorkflowVars) error {
+			_, err := undo(rc, vars)
+			return err
+		})
+	})
+
+	if err := in.run(spec.Steps); err != nil {
+		return in.vars, err
+	}
+	return in.vars, nil
+}
+
+type specInterpreter struct {
+	ctx     restate.WorkflowContext
+	spec    *WorkflowSpec
+	saga    *SagaFramework
+	vars    WorkflowVars
+	tracker *ProgressTracker
+
+	// expected is the step count reported to a tracker the interpreter
+	// owns; zero leaves another owner's count alone
+	expected int
+}
+
+func (in *specInterpreter) run(steps []WorkflowSpecStep) error {
+	for i := range steps {
+		step := &steps[i]
+		in.tracker.StepStarted(step.Name, step.Status)
+
+		var err error
+		switch step.kind() {
+		case WorkflowSpecActivity:
+			err = in.activity(step)
+		case WorkflowSpecBranch:
+			cond, _ := parseSpecCondition(step.If)
+			branch := step.Else
+			if cond.eval(in.vars) {
+				branch = step.Then
+			}
+			in.ctx.Log().Info("workflow_spec.branch", "step", step.Name, "if", step.If, "taken", len(branch) > 0)
+			if in.expected > 0 {
+				in.expected += len(branch)
+				in.tracker.ExpectSteps(in.expected)
+			}
+			err = in.run(branch)
+		case WorkflowSpecSleep:
+			d, _ := parseSpecDuration(step.Duration)
+			err = restate.Sleep(in.ctx, d)
+		case WorkflowSpecApproval:
+			err = in.approval(step)
+		}
+		if err != nil {
+			in.tracker.StepFailed(step.Name, err)
+			return fmt.Errorf("step %s failed: %w", step.Name, err)
+		}
+		in.tracker.StepCompleted(step.Name)
+	}
+	return nil
+}
+
+// activity runs an activity with the step input layered over the workflow
+// variables and merges its result back. The compensation receives the
+// variables as they stood after the step.
+func (in *specInterpreter) activity(step *WorkflowSpecStep) error {
+	fn, _ := lookupWorkflowActivity(step.Activity)
+	input := make(WorkflowVars, len(in.vars)+len(step.Input))
+	for k, v := range in.vars {
+		input[k] = v
+	}
+	for k, v := range step.Input {
+		input[k] = v
+	}
+
+	if step.Compensate != "" {
+		if err := in.saga.Add(step.Name, input, false); err != nil {
+			return err
+		}
+	}
+
+	result, err := in.attempts(step, fn, input)
+	if err != nil {
+		return err
+	}
+	for k, v := range result {
+		in.vars[k] = v
+		input[k] = v
+	}
+
+	if step.Compensate != "" {
+		raw, err := canonicalJSON(input)
+		if err != nil {
+			return fmt.Errorf("saga: marshal step result: %w", err)
+		}
+		return in.saga.markStep(step.Name, SagaStepCompleted, raw)
+	}
+	return nil
+}
+
+// attempts runs an activity under the step's retry policy.
+func (in *specInterpreter) attempts(step *WorkflowSpecStep, fn WorkflowActivity, input WorkflowVars) (WorkflowVars, error) {
+	policy := step.Retry.policy()
+	action := func(rc restate.RunContext) (WorkflowVars, error) {
+		return fn(rc, input)
+	}
+
+	var result WorkflowVars
+	attempts, exhausted, err := retryWithPolicy(in.ctx, policy, "workflow_spec."+step.Name, func(attempt int) error {
+		var err error
+		result, err = runAttempt(in.ctx, policy, attempt+1, action,
+			restate.WithName(fmt.Sprintf("%s#%d", step.Name, attempt+1)))
+		return err
+	})
+	switch {
+	case err == nil:
+		return result, nil
+	case exhausted:
+		return nil, restate.TerminalError(fmt.Errorf("activity %s exhausted %d attempts: %w", step.Activity, attempts, err), 500)
+	default:
+		return nil, err
+	}
+}
+
+// approval waits for ResolveWorkflowSpecApproval and records the decision
+// under the step name. A rejection fails the workflow with 403.
+func (in *specInterpreter) approval(step *WorkflowSpecStep) error {
+	promise := restate.Promise[WorkflowSpecDecision](in.ctx, workflowSpecPromiseName(step.Name))
+	in.ctx.Log().Info("workflow_spec.awaiting_approval", "step", step.Name)
+
+	var decision WorkflowSpecDecision
+	timeout, _ := parseSpecDuration(step.Timeout)
+	if timeout <= 0 {
+		d, err := promise.Result()
+		if err != nil {
+			return err
+		}
+		decision = d
+	} else {
+		timer := restate.After(in.ctx, timeout)
+		winner, err := restate.WaitFirst(in.ctx, promise, timer)
+		if err != nil {
+			return err
+		}
+		if winner == timer {
+			decision = WorkflowSpecDecision{Step: step.Name, Approved: step.OnTimeout == "approve", By: "timeout"}
+		} else if decision, err = promise.Result(); err != nil {
+			return err
+		}
+	}
+
+	in.vars[step.Name] = map[string]any{"approved": decision.Approved, "by": decision.By, "comment": decision.Comment}
+	if !decision.Approved {
+		return restate.TerminalError(fmt.Errorf("approval %s rejected by %s", step.Name, decision.By), 403)
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// Section 4F: Durable Schedules
+// -----------------------------------------------------------------------------
+
+const (
+	// SchedulerServiceName is the service name Scheduler is bound under by restate.Reflect.
+	SchedulerServiceName = "Scheduler"
+
+	// SchedulerIndexServiceName is the service name SchedulerIndex is bound under.
+	SchedulerIndexServiceName = "SchedulerIndex"
+
+	scheduleIndexKey = "all"
+)
+
+// MissedRunPolicy decides what happens to occurrences that passed while a
+// tick was late, e.g. because the scheduler's deployment was down.
+type MissedRunPolicy string
+
+const (
+	// MissedRunSkip drops missed occurrences and waits for the next one (default)
+	MissedRunSkip MissedRunPolicy = "skip"
+
+	// MissedRunCatchUp fires missed occurrences one after another, up to MaxCatchUp
+	MissedRunCatchUp MissedRunPolicy = "catch_up"
+)
+
+// ScheduleTargetKind is the kind of handler a schedule invokes.
+type ScheduleTargetKind string
+
+const (
+	ScheduleTargetService  ScheduleTargetKind = "service"
+	ScheduleTargetObject   ScheduleTargetKind = "object"
+	ScheduleTargetWorkflow ScheduleTargetKind = "workflow"
+)
+
+// ScheduleTarget is the handler a schedule sends to on every occurrence.
+// Build it with ServiceScheduleTarget, ObjectScheduleTarget or
+// WorkflowScheduleTarget.
+type ScheduleTarget struct {
+	Kind        ScheduleTargetKind `json:"kind"`
+	ServiceName string             `json:"service_name"`
+	HandlerName string             `json:"handler_name"`
+
+	// Key is the object key, or the workflow ID prefix; each occurrence
+	// starts workflow "<Key>-<occurrence time>"
+	Key   string          `json:"key,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+// ServiceScheduleTarget targets a service handler.
+func ServiceScheduleTarget[I, O any](client ServiceClient[I, O], input I) (ScheduleTarget, error) {
+	return newScheduleTarget(ScheduleTargetService, client.ServiceName, client.HandlerName, "", input)
+}
+
+// ObjectScheduleTarget targets a Virtual Object handler on a fixed key.
+func ObjectScheduleTarget[I, O any](client ObjectClient[I, O], key string, input I) (ScheduleTarget, error) {
+	return newScheduleTarget(ScheduleTargetObject, client.ServiceName, client.HandlerName, key, input)
+}
+
+// WorkflowScheduleTarget starts a new workflow per occurrence, with IDs
+// derived from idPrefix and the occurrence time.
+func WorkflowScheduleTarget[I, O any](client WorkflowClient[I, O], idPrefix string, input I) (ScheduleTarget, error) {
+	return newScheduleTarget(ScheduleTargetWorkflow, client.ServiceName, client.HandlerName, idPrefix, input)
+}
+
+func newScheduleTarget(kind ScheduleTargetKind, service, handler, key string, input any) (ScheduleTarget, error) {
+	raw, err := json.Marshal(input)
+	if err != nil {
+		return ScheduleTarget{}, fmt.Errorf("schedule: marshal input: %w", err)
+	}
+	return ScheduleTarget{Kind: kind, ServiceName: service, HandlerName: handler, Key: key, Input: raw}, nil
+}
+
+// send invokes the target for one occurrence. The occurrence time makes the
+// invocation idempotent, so a replayed tick cannot fire twice.
+func (t ScheduleTarget) send(ctx restate.ObjectContext, scheduleID string, due time.Time) {
+	occurrence := due.UTC().Format("2006-01-02T15:04:05Z")
+	idem := restate.WithIdempotencyKey("schedule/" + scheduleID + "/" + occurrence)
+	var input any = t.Input
+	if len(t.Input) == 0 {
+		input = nil
+	}
+
+	switch t.Kind {
+	case ScheduleTargetService:
+		restate.ServiceSend(ctx, t.ServiceName, t.HandlerName).Send(input, idem)
+	case ScheduleTargetObject:
+		restate.ObjectSend(ctx, t.ServiceName, t.Key, t.HandlerName).Send(input, idem)
+	case ScheduleTargetWorkflow:
+		prefix := t.Key
+		if prefix == "" {
+			prefix = scheduleID
+		}
+		restate.WorkflowSend(ctx, t.ServiceName, prefix+"-"+occurrence, t.HandlerName).Send(input)
+	}
+}
+
+func (t ScheduleTarget) validate() error {
+	switch t.Kind {
+	case ScheduleTargetService, ScheduleTargetWorkflow:
+	case ScheduleTargetObject:
+		if t.Key == "" {
+			return fmt.Errorf("object target requires a key")
+		}
+	default:
+		return fmt.Errorf("unknown target kind %q", t.Kind)
+	}
+	if t.ServiceName == "" || t.HandlerName == "" {
+		return fmt.Errorf("target service and handler are required")
+	}
+	return nil
+}
+
+// ScheduleSpec defines a recurring schedule. Exactly one of Cron and Every is set.
+type ScheduleSpec struct {
+	// Cron is a five-field expression (minute hour day-of-month month
+	// day-of-week) or one of @yearly, @monthly, @weekly, @daily, @hourly
+	Cron string `json:"cron,omitempty"`
+
+	// Every fires at a fixed interval counted from the moment the schedule is
+	// created; Resume and skipped runs keep that phase
+	Every time.Duration `json:"every,omitempty"`
+
+	// Timezone is an IANA zone for Cron; defaults to UTC
+	Timezone string `json:"timezone,omitempty"`
+
+	Target     ScheduleTarget  `json:"target"`
+	MissedRuns MissedRunPolicy `json:"missed_runs,omitempty"`
+	MaxCatchUp int             `json:"max_catch_up,omitempty"` // default 10
+}
+
+// ScheduleStatus is the state of a schedule as reported by Get and List.
+type ScheduleStatus struct {
+	ID        string       `json:"id"`
+	Spec      ScheduleSpec `json:"spec"`
+	Paused    bool         `json:"paused"`
+	NextRun   time.Time    `json:"next_run,omitempty"`
+	LastRun   time.Time    `json:"last_run,omitempty"`
+	Runs      int          `json:"runs"`
+	Skipped   int          `json:"skipped"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// scheduleState is the Scheduler's persisted state. Token changes on every
+// create, pause and resume so ticks sent for an older arm are ignored.
+// Anchor is the creation time that Every schedules are phased on.
+type scheduleState struct {
+	Status  ScheduleStatus `json:"status"`
+	Token   string         `json:"token"`
+	Anchor  time.Time      `json:"anchor"`
+	CatchUp int            `json:"catch_up"`
+}
+
+type scheduleTick struct {
+	Token string    `json:"token"`
+	Due   time.Time `json:"due"`
+}
+
+// Scheduler is a Virtual Object, keyed by schedule ID, that fires a target
+// on a cron expression or interval. It re-arms itself with a delayed Send,
+// so schedules survive restarts without an external cron.
+//
+//	server.Bind(restate.Reflect(framework.Scheduler{})).
+//	    Bind(restate.Reflect(framework.SchedulerIndex{}))
+type Scheduler struct{}
+
+const scheduleStateKey = "schedule"
+
+// Create installs or replaces the schedule and arms its first occurrence.
+func (Scheduler) Create(ctx restate.ObjectContext, spec ScheduleSpec) (ScheduleStatus, error) {
+	if spec.MissedRuns == "" {
+		spec.MissedRuns = MissedRunSkip
+	}
+	if spec.MaxCatchUp <= 0 {
+		spec.MaxCatchUp = 10
+	}
+	if _, err := spec.schedule(time.Time{}); err != nil {
+		return ScheduleStatus{}, restate.TerminalError(fmt.Errorf("schedule %s: %w", restate.Key(ctx), err), 400)
+	}
+	if err := spec.Target.validate(); err != nil {
+		return ScheduleStatus{}, restate.TerminalError(fmt.Errorf("schedule %s: %w", restate.Key(ctx), err), 400)
+	}
+
+	now, err := scheduleNow(ctx)
+	if err != nil {
+		return ScheduleStatus{}, err
+	}
+	st := &scheduleState{
+		Status: ScheduleStatus{ID: restate.Key(ctx), Spec: spec, CreatedAt: now},
+		Anchor: now,
+	}
+	if err := st.arm(ctx, now, now); err != nil {
+		return ScheduleStatus{}, err
+	}
+	ctx.Log().Info("schedule.created", "schedule", st.Status.ID, "next_run", st.Status.NextRun)
+	return st.Status, nil
+}
+
+// Tick fires a due occurrence and arms the next one.
+func (Scheduler) Tick(ctx restate.ObjectContext, tick scheduleTick) (restate.Void, error) {
+	st, err := restate.Get[*scheduleState](ctx, scheduleStateKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	if st == nil || st.Token != tick.Token || st.Status.Paused {
+		return restate.Void{}, nil
+	}
+	now, err := scheduleNow(ctx)
+	if err != nil {
+		return restate.Void{}, err
+	}
+
+	st.Status.Spec.Target.send(ctx, st.Status.ID, tick.Due)
+	st.Status.LastRun = tick.Due
+	st.Status.Runs++
+	ctx.Log().Info("schedule.fired", "schedule", st.Status.ID, "due", tick.Due, "late", now.Sub(tick.Due).String())
+
+	sched, _ := st.Status.Spec.schedule(st.Anchor)
+	next := sched.next(tick.Due)
+	missed, catchUp := st.missedRun(next, now)
+	switch {
+	case !missed:
+		return restate.Void{}, st.arm(ctx, now, tick.Due)
+	case catchUp:
+		return restate.Void{}, st.armAt(ctx, now, next)
+	default:
+		return restate.Void{}, st.arm(ctx, now, now)
+	}
+}
+
+// missedRun reports whether next, the occurrence after the one that just
+// fired, has already passed, and if so whether the policy fires it at once.
+// Consecutive catch-up fires are counted against MaxCatchUp.
+func (st *scheduleState) missedRun(next, now time.Time) (missed, catchUp bool) {
+	if next.IsZero() || !next.Before(now) {
+		st.CatchUp = 0
+		return false, false
+	}
+	if st.Status.Spec.MissedRuns == MissedRunCatchUp && st.CatchUp < st.Status.Spec.MaxCatchUp {
+		st.CatchUp++
+		return true, true
+	}
+	st.CatchUp = 0
+	return true, false
+}
+
+// Pause stops firing until Resume. Occurrences during the pause are skipped.
+func (Scheduler) Pause(ctx restate.ObjectContext) (ScheduleStatus, error) {
+	st, err := loadSchedule(ctx)
+	if err != nil {
+		return ScheduleStatus{}, err
+	}
+	st.Status.Paused = true
+	st.Status.NextRun = time.Time{}
+	st.Token = ""
+	st.save(ctx)
+	ctx.Log().Info("schedule.paused", "schedule", st.Status.ID)
+	return st.Status, nil
+}
+
+// Resume re-arms a paused schedule from now.
+func (Scheduler) Resume(ctx restate.ObjectContext) (ScheduleStatus, error) {
+	st, err := loadSchedule(ctx)
+	if err != nil {
+		return ScheduleStatus{}, err
+	}
+	if !st.Status.Paused {
+		return st.Status, nil
+	}
+	now, err := scheduleNow(ctx)
+	if err != nil {
+		return ScheduleStatus{}, err
+	}
+	st.Status.Paused = false
+	st.CatchUp = 0
+	if err := st.arm(ctx, now, now); err != nil {
+		return ScheduleStatus{}, err
+	}
+	ctx.Log().Info("schedule.resumed", "schedule", st.Status.ID, "next_run", st.Status.NextRun)
+	return st.Status, nil
+}
+
+// Delete removes the schedule; its pending tick becomes a no-op.
+func (Scheduler) Delete(ctx restate.ObjectContext) (restate.Void, error) {
+	restate.ClearAll(ctx)
+	ObjectClient[string, restate.Void]{
+		ServiceName: SchedulerIndexServiceName,
+		HandlerName: "Remove",
+	}.Send(ctx, scheduleIndexKey, restate.Key(ctx))
+	return restate.Void{}, nil
+}
+
+// Get returns the schedule's status.
+func (Scheduler) Get(ctx restate.ObjectSharedContext) (ScheduleStatus, error) {
+	st, err := loadSchedule(ctx)
+	if err != nil {
+		return ScheduleStatus{}, err
+	}
+	return st.Status, nil
+}
+
+func loadSchedule(ctx restate.ObjectSharedContext) (*scheduleState, error) {
+	st, err := restate.Get[*scheduleState](ctx, scheduleStateKey)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return nil, restate.TerminalError(fmt.Errorf("schedule %s not found", restate.Key(ctx)), 404)
+	}
+	return st, nil
+}
+
+func scheduleNow(ctx restate.Context) (time.Time, error) {
+	return RunDo(ctx, func(rc restate.RunContext) (time.Time, error) {
+		return time.Now().UTC(), nil
+	}, restate.WithName("schedule.now"))
+}
+
+// arm schedules the first occurrence after from, counting occurrences
+// skipped between the last run and from.
+func (st *scheduleState) arm(ctx restate.ObjectContext, now, from time.Time) error {
+	sched, err := st.Status.Spec.schedule(st.Anchor)
+	if err != nil {
+		return err
+	}
+	if !st.Status.LastRun.IsZero() {
+		for t := sched.next(st.Status.LastRun); !t.IsZero() && t.Before(from); t = sched.next(t) {
+			st.Status.Skipped++
+		}
+	}
+	next := sched.next(from)
+	if next.IsZero() {
+		st.Status.NextRun = time.Time{}
+		st.save(ctx)
+		ctx.Log().Warn("schedule.exhausted", "schedule", st.Status.ID)
+		return nil
+	}
+	return st.armAt(ctx, now, next)
+}
+
+// armAt sends the tick for due under a fresh token.
+func (st *scheduleState) armAt(ctx restate.ObjectContext, now, due time.Time) error {
+	st.Token = restate.UUID(ctx).String()
+	st.Status.NextRun = due
+	st.save(ctx)
+
+	delay := due.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	ObjectClient[scheduleTick, restate.Void]{
+		ServiceName: SchedulerServiceName,
+		HandlerName: "Tick",
+	}.Send(ctx, st.Status.ID, scheduleTick{Token: st.Token, Due: due}, CallOption{Delay: delay})
+	return nil
+}
+
+func (st *scheduleState) save(ctx restate.ObjectContext) {
+	restate.Set(ctx, scheduleStateKey, *st)
+	ObjectClient[ScheduleStatus, restate.Void]{
+		ServiceName: SchedulerIndexServiceName,
+		HandlerName: "Put",
+	}.Send(ctx, scheduleIndexKey, st.Status)
+}
+
+// SchedulerIndex is a single-key Virtual Object listing all schedules.
+// Scheduler keeps it up to date.
+type SchedulerIndex struct{}
+
+const scheduleIndexStateKey = "schedules"
+
+// Put records a schedule's latest status.
+func (SchedulerIndex) Put(ctx restate.ObjectContext, status ScheduleStatus) (restate.Void, error) {
+	all, err := restate.Get[map[string]ScheduleStatus](ctx, scheduleIndexStateKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	if all == nil {
+		all = make(map[string]ScheduleStatus)
+	}
+	all[status.ID] = status
+	restate.Set(ctx, scheduleIndexStateKey, all)
+	return restate.Void{}, nil
+}
+
+// Remove forgets a deleted schedule.
+func (SchedulerIndex) Remove(ctx restate.ObjectContext, id string) (restate.Void, error) {
+	all, err := restate.Get[map[string]ScheduleStatus](ctx, scheduleIndexStateKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	delete(all, id)
+	restate.Set(ctx, scheduleIndexStateKey, all)
+	return restate.Void{}, nil
+}
+
+// List returns every schedule sorted by ID. Call it on key "all".
+func (SchedulerIndex) List(ctx restate.ObjectSharedContext) ([]ScheduleStatus, error) {
+	all, err := restate.Get[map[string]ScheduleStatus](ctx, scheduleIndexStateKey)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]ScheduleStatus, 0, len(all))
+	for _, status := range all {
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// recurrence yields successive occurrence times.
+type recurrence interface {
+	// next returns the first occurrence strictly after t, or zero if none
+	next(t time.Time) time.Time
+}
+
+func (spec ScheduleSpec) schedule(anchor time.Time) (recurrence, error) {
+	switch {
+	case spec.Cron != "" && spec.Every > 0:
+		return nil, fmt.Errorf("set either cron or every, not both")
+	case spec.Every > 0:
+		return intervalRecurrence{every: spec.Every, anchor: anchor}, nil
+	case spec.Cron != "":
+		loc := time.UTC
+		if spec.Timezone != "" {
+			l, err := time.LoadLocation(spec.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("timezone: %w", err)
+			}
+			loc = l
+		}
+		return parseCron(spec.Cron, loc)
+	default:
+		return nil, fmt.Errorf("cron or every is required")
+	}
+}
+
+// intervalRecurrence fires at anchor plus whole multiples of every, so a
+// schedule re-armed from an arbitrary time keeps its phase.
+type intervalRecurrence struct {
+	every  time.Duration
+	anchor time.Time
+}
+
+func (r intervalRecurrence) next(t time.Time) time.Time {
+	if r.anchor.IsZero() {
+		return t.Add(r.every)
+	}
+	if t.Before(r.anchor) {
+		return r.anchor.Add(r.every)
+	}
+	periods := t.Sub(r.anchor)/r.every + 1
+	return r.anchor.Add(periods * r.every)
+}
+
+// cronRecurrence matches five-field cron expressions. Each field is a
+// bitset of allowed values.
+type cronRecurrence struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	loc                           *time.Location
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	cronDayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+func parseCron(expr string, loc *time.Location) (*cronRecurrence, error) {
+	if full, ok := cronDescriptors[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = full
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	// As in Vixie cron, a field starting with "*" (including "*/n") counts as
+	// unrestricted for the day-of-month/day-of-week OR rule
+	c := &cronRecurrence{loc: loc, domStar: strings.HasPrefix(fields[2], "*"), dowStar: strings.HasPrefix(fields[4], "*")}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: minute: %w", expr, err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: hour: %w", expr, err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: day of month: %w", expr, err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("cron %q: month: %w", expr, err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return nil, fmt.Errorf("cron %q: day of week: %w", expr, err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1 // 7 is Sunday too
+	}
+	return c, nil
+}
+
+// parseCronField parses lists of values, ranges and steps: "*/15", "1-5", "mon,wed".
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	value := func(s string) (int, error) {
+		if n, ok := names[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("value %q out of range %d-%d", s, min, max)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			n, err := value(rangePart)
+			if err != nil {
+				return 0, err
+			}
+			lo = n
+			if step == 1 {
+				hi = n
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronRecurrence) next(t time.Time) time.Time {
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches applies cron's rule that a restricted day-of-month and
+// day-of-week match when either does.
+func (c *cronRecurrence) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// -----------------------------------------------------------------------------
+// Section 5: Control Plane Service
+// -----------------------------------------------------------------------------
+
+// ControlPlaneService provides orchestration capabilities with built-in saga management.
+type ControlPlaneService struct {
+	name              string
+	saga              *SagaFramework
+	idempotencyPrefix string
+}
+
+// NewControlPlaneService creates an orchestrator with automatic saga setup.
+func NewControlPlaneService(ctx restate.WorkflowContext, name string, idempotencyPrefix string) *ControlPlaneService {
+	return &ControlPlaneService{
+		name:              name,
+		saga:              NewSaga(ctx, name, nil),
+		idempotencyPrefix: idempotencyPrefix,
+	}
+}
+
+// Orchestrate executes a function within a saga context with automatic compensation.
+// Failures are resolved according to the saga's recovery mode.
+func (cp *ControlPlaneService) Orchestrate(fn func() error) (err error) {
+	defer cp.saga.RecoverIfNeeded(&err)
+	return fn()
+}
+
+// RegisterCompensation adds a compensation handler to the saga.
+func (cp *ControlPlaneService) RegisterCompensation(name string, fn SagaCompensationFunc) {
+	cp.saga.Register(name, fn)
+}
+
+// AddCompensationStep persists a compensation step before executing main action.
+func (cp *ControlPlaneService) AddCompensationStep(name string, payload any, dedupe bool, opts ...SagaStepOption) error {
+	return cp.saga.Add(name, payload, dedupe, opts...)
+}
+
+// MarkStepCompleted records that the latest pending step with this name succeeded.
+func (cp *ControlPlaneService) MarkStepCompleted(name string) error {
+	return cp.saga.MarkCompleted(name)
+}
+
+// MarkStepFailed records that the latest pending step with this name failed without effects.
+func (cp *ControlPlaneService) MarkStepFailed(name string) error {
+	return cp.saga.MarkFailed(name)
+}
+
+// AwaitHumanApproval coordinates human-in-the-loop with durable timeout.
+func (cp *ControlPlaneService) AwaitHumanApproval(
+	ctx restate.Context,
+	approvalID string,
+	timeout time.Duration,
+) (approved bool, err error) {
+	awakeable := WaitForExternalSignal[bool](ctx)
+	awakeableID := awakeable.Id()
+
+	ctx.Log().Info("controlplane.awaiting_approval", "approval_id", approvalID, "awakeable_id", awakeableID)
+
+	// Race against timeout
+	result, timedOut, err := RaceAwakeableWithTimeout(ctx, awakeable, timeout, false)
+	if err != nil {
+		return false, fmt.Errorf("approval race failed: %w", err)
+	}
+	if timedOut {
 		ctx.Log().Warn("controlplane.approval_timeout", "approval_id", approvalID)
 		return false, restate.TerminalError(fmt.Errorf("approval timeout after %v", timeout), 408)
 	}
 
-	// Get approval result
-	result, err := awakeable.Result()
-	if err != nil {
-		return false, fmt.Errorf("approval result failed: %w", err)
+	ctx.Log().Info("controlplane.approval_result", "approval_id", approvalID, "approved", result)
+	return result, nil
+}
+
+// GenerateIdempotencyKey creates a deterministic idempotency key for external calls.
+// Uses restate.UUID to ensure deterministic generation across retries.
+// IMPORTANT: Must be called from within a durable handler context.
+func (cp *ControlPlaneService) GenerateIdempotencyKey(ctx restate.Context, suffix string) string {
+	// Use deterministic UUID seeded by invocation ID
+	uuid := restate.UUID(ctx)
+	return fmt.Sprintf("%s:%s:%s", cp.idempotencyPrefix, suffix, uuid.String())
+}
+
+// GenerateIdempotencyKeyDeterministic creates an idempotency key using only deterministic inputs.
+// Use this when you need a predictable key based on business data (e.g., user ID + order ID).
+func (cp *ControlPlaneService) GenerateIdempotencyKeyDeterministic(businessKeys ...string) string {
+	if len(businessKeys) == 0 {
+		return cp.idempotencyPrefix
+	}
+	// Join all keys with deterministic separator
+	combined := fmt.Sprintf("%s:%s", cp.idempotencyPrefix, path.Join(businessKeys...))
+	return combined
+}
+
+// SafeStep enforces "register compensation BEFORE action" pattern
+//
+// Deprecated: use NewStep, whose compensation receives the action's typed result.
+type SafeStep[T any] struct {
+	saga         *SagaFramework
+	name         string
+	compensation SagaCompensationFunc
+	registered   bool
+	executed     bool
+}
+
+// NewSafeStep creates a step that enforces compensation-before-action
+//
+// Deprecated: use NewStep.
+func (s *SagaFramework) NewSafeStep(name string) *SafeStep[any] {
+	return &SafeStep[any]{
+		saga: s,
+		name: name,
+	}
+}
+
+// WithCompensation registers the compensation (MUST be called before Execute)
+func (step *SafeStep[T]) WithCompensation(compensation SagaCompensationFunc) *SafeStep[T] {
+	if step.executed {
+		panic(fmt.Sprintf("saga: cannot register compensation after action execution: %s", step.name))
+	}
+	step.compensation = compensation
+	step.registered = true
+	return step
+}
+
+// Execute runs the action (compensation must be registered first)
+func (step *SafeStep[T]) Execute(
+	ctx restate.Context,
+	action func() (T, error),
+) (T, error) {
+	var zero T
+
+	if !step.registered {
+		return zero, restate.TerminalError(
+			fmt.Errorf("saga: must register compensation before executing action: %s", step.name),
+			500,
+		)
+	}
+
+	if step.executed {
+		return zero, restate.TerminalError(
+			fmt.Errorf("saga: action already executed: %s", step.name),
+			500,
+		)
+	}
+
+	// Register and persist compensation first
+	step.saga.Register(step.name, step.compensation)
+	if err := step.saga.Add(step.name, nil, false); err != nil {
+		return zero, err
+	}
+
+	// Then execute action
+	result, err := restate.Run(step.saga.ctx, func(rc restate.RunContext) (T, error) {
+		return action()
+	}, restate.WithName(step.name))
+
+	step.executed = true
+
+	if err != nil {
+		// Error will trigger compensation automatically
+		return zero, err
+	}
+
+	return result, step.saga.MarkCompleted(step.name)
+}
+
+// StepResult is the payload a Step persists for its compensation. Completed
+// is false when the action failed or never returned, in which case Value is
+// the zero value and the compensation must undo any partial effects itself.
+type StepResult[T any] struct {
+	Value     T    `json:"value"`
+	Completed bool `json:"completed"`
+}
+
+// Step is a typed saga step whose compensation receives the action's result,
+// such as the charge ID returned by a payment call.
+type Step[T any] struct {
+	saga *SagaFramework
+	name string
+}
+
+// NewStep registers a typed step with its compensation. Call it on every
+// execution, before Run, so the handler is available after a restart.
+//
+//	charge := framework.NewStep(saga, "charge_card",
+//	    func(rc restate.RunContext, res framework.StepResult[string]) error {
+//	        if !res.Completed {
+//	            return payments.VoidPending(order.ID)
+//	        }
+//	        return payments.Refund(res.Value)
+//	    })
+//	chargeID, err := charge.Run(func(rc restate.RunContext) (string, error) {
+//	    return payments.Charge(order.Card, order.Amount)
+//	})
+func NewStep[T any](s *SagaFramework, name string, compensate func(rc restate.RunContext, result StepResult[T]) error) *Step[T] {
+	if compensate != nil {
+		s.Register(name, typedCompensation(name, compensate))
+	} else {
+		s.log.Warn("saga.new_step: nil compensation", "name", name)
+	}
+	return &Step[T]{saga: s, name: name}
+}
+
+// Run persists the step as pending, executes action inside restate.Run and
+// then persists its result with the step marked completed. On replay the
+// journaled result is returned without re-running the action.
+func (st *Step[T]) Run(action func(rc restate.RunContext) (T, error), opts ...SagaStepOption) (T, error) {
+	var zero T
+	if err := st.saga.Add(st.name, StepResult[T]{}, false, opts...); err != nil {
+		return zero, err
+	}
+
+	result, err := restate.Run(st.saga.ctx, action, restate.WithName(st.name))
+	if err != nil {
+		// Left pending: the action may have had partial effects
+		return zero, err
+	}
+
+	raw, err := canonicalJSON(StepResult[T]{Value: result, Completed: true})
+	if err != nil {
+		return zero, fmt.Errorf("saga: marshal step result: %w", err)
+	}
+	if err := st.saga.markStep(st.name, SagaStepCompleted, raw); err != nil {
+		return zero, err
+	}
+	return result, nil
+}
+
+// CompensationStrategy defines how to handle partial compensation
+type CompensationStrategy int
+
+const (
+	// CompensateAll runs all compensations (default, all-or-nothing)
+	CompensateAll CompensationStrategy = iota
+
+	// CompensateCompleted only compensates steps marked via MarkCompleted
+	CompensateCompleted
+
+	// CompensateBestEffort tries all compensations, continues on errors
+	CompensateBestEffort
+
+	// CompensateUntilSuccess stops after first successful compensation
+	CompensateUntilSuccess
+)
+
+// PartialCompensationConfig configures partial compensation behavior
+type PartialCompensationConfig struct {
+	Strategy        CompensationStrategy
+	ContinueOnError bool
+	MaxRetries      int
+}
+
+// SetCompensationStrategy configures how compensations are executed
+func (s *SagaFramework) SetCompensationStrategy(strategy CompensationStrategy) {
+	// Store strategy in saga namespace state
+	s.state.set(fmt.Sprintf("%s:strategy", s.nsKey), int(strategy))
+}
+
+// RollbackWithStrategy executes compensations with the specified strategy
+// Simplified version that works with existing saga implementation.
+// Failed steps are never compensated; CompensateCompleted also skips
+// steps that were never marked completed.
+func (s *SagaFramework) RollbackWithStrategy(
+	ctx restate.Context,
+	strategy CompensationStrategy,
+) error {
+	// Get compensation entries
+	entries, err := getSagaState[[]SagaEntry](s.state, s.nsKey)
+	if err != nil || len(entries) == 0 {
+		s.log.Info("saga: no compensations to execute")
+		return nil
+	}
+
+	s.log.Info("saga: starting compensations",
+		"count", len(entries),
+		"strategy", strategyName(strategy))
+
+	s.batchTimeline = true
+	defer func() {
+		s.batchTimeline = false
+		s.flushTimeline()
+	}()
+
+	// Execute compensations in reverse order
+	var compensationErrors []error
+
+	for idx := len(entries) - 1; idx >= 0; idx-- {
+		entry := entries[idx]
+
+		if !entry.needsCompensation(strategy) {
+			s.record(SagaTimelineEvent{
+				Kind: SagaEventCompensationSkipped, Step: entry.Name, StepID: entry.StepID,
+				Note: fmt.Sprintf("status %s", entry.effectiveStatus()),
+			})
+			s.log.Info("saga: skipping compensation",
+				"step", entry.Name,
+				"status", entry.effectiveStatus(),
+				"strategy", strategyName(strategy))
+			continue
+		}
+
+		undo, ok := s.undo(entry.Name)
+		if !ok {
+			s.log.Warn("saga: no compensation handler", "name", entry.Name)
+			if strategy != CompensateBestEffort {
+				return fmt.Errorf("missing compensation handler: %s", entry.Name)
+			}
+			continue
+		}
+
+		payload, err := s.payload(entry)
+		if err != nil {
+			s.log.Warn("saga: payload migration failed", "name", entry.Name, "error", err.Error())
+			if strategy != CompensateBestEffort {
+				return err
+			}
+			continue
+		}
+
+		s.log.Info("saga: executing compensation",
+			"step", entry.Name,
+			"strategy", strategyName(strategy))
+
+		attemptStart := s.now()
+		s.record(SagaTimelineEvent{
+			Kind: SagaEventCompensationAttempt, Step: entry.Name, StepID: entry.StepID,
+			Attempt: entry.Attempt + 1, At: attemptStart,
+		})
+		runErr := undo.run(ctx, entry, payload, sagaIdempotencyKey(s.nsKey, entry),
+			fmt.Sprintf("compensate-%s", entry.Name), s.cfg.compensationPolicy(), s.compensationTimeout(entry, undo))
+
+		result := SagaTimelineEvent{
+			Kind: SagaEventCompensationSucceeded, Step: entry.Name, StepID: entry.StepID,
+			Attempt: entry.Attempt + 1, At: s.now(),
+		}
+		result.Duration = result.At.Sub(attemptStart)
+		if runErr != nil {
+			result.Kind, result.Error = SagaEventCompensationFailed, runErr.Error()
+		}
+		s.record(result)
+
+		if runErr != nil {
+			compensationErrors = append(compensationErrors,
+				fmt.Errorf("compensation failed for %s: %w", entry.Name, runErr))
+
+			// Handle error based on strategy
+			if strategy == CompensateBestEffort {
+				// Continue with next compensation
+				s.log.Warn("saga: compensation failed, continuing",
+					"step", entry.Name,
+					"error", runErr.Error())
+				continue
+			} else if strategy != CompensateUntilSuccess {
+				// Stop on error for other strategies
+				break
+			}
+		} else {
+			// Compensation succeeded
+			// Remove from list
+			entries = removeIndex(entries, idx)
+			s.state.set(s.nsKey, entries)
+
+			if strategy == CompensateUntilSuccess {
+				// Stop after first success
+				break
+			}
+		}
+	}
+
+	if len(compensationErrors) > 0 && strategy != CompensateBestEffort {
+		return fmt.Errorf("saga rollback encountered %d errors: %v",
+			len(compensationErrors), compensationErrors[0])
+	}
+
+	return nil
+}
+
+// Helper function to get strategy name for logging
+func strategyName(strategy CompensationStrategy) string {
+	switch strategy {
+	case CompensateAll:
+		return "compensate-all"
+	case CompensateCompleted:
+		return "compensate-completed"
+	case CompensateBestEffort:
+		return "compensate-best-effort"
+	case CompensateUntilSuccess:
+		return "compensate-until-success"
+	default:
+		return "unknown"
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Section 5A: Human Tasks
+// -----------------------------------------------------------------------------
+
+// HumanTaskInboxServiceName is the service name HumanTaskInbox is bound under
+// by restate.Reflect.
+const HumanTaskInboxServiceName = "HumanTaskInbox"
+
+// HumanTask describes an approval requested from people.
+type HumanTask struct {
+	// ID is unique within the calling workflow or object
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+
+	// Approvers are inbox keys; each gets one vote
+	Approvers []string `json:"approvers"`
+
+	// Quorum is the number of approvals needed. Default: 1. The task is
+	// rejected as soon as the quorum can no longer be reached.
+	Quorum int `json:"quorum,omitempty"`
+
+	// ReminderEvery re-notifies approvers who have not decided yet
+	ReminderEvery time.Duration `json:"reminder_every,omitempty"`
+
+	// EscalateTo receives the task after EscalateAfter without a decision;
+	// their vote decides the task on its own
+	EscalateTo    string        `json:"escalate_to,omitempty"`
+	EscalateAfter time.Duration `json:"escalate_after,omitempty"`
+
+	// Timeout ends the task undecided with a terminal 408
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// HumanTaskAssignment is a task waiting in an assignee's inbox.
+type HumanTaskAssignment struct {
+	TaskKey     string    `json:"task_key"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	AwakeableID string    `json:"awakeable_id"`
+	OnBehalfOf  string    `json:"on_behalf_of,omitempty"` // original approver of a delegated task
+	DelegatedBy string    `json:"delegated_by,omitempty"`
+	Escalation  bool      `json:"escalation,omitempty"`
+	AssignedAt  time.Time `json:"assigned_at"`
+	Reminders   int       `json:"reminders"`
+
+	// Delegations is the hand-over history, carried into the vote
+	Delegations []HumanTaskEvent `json:"delegations,omitempty"`
+}
+
+// HumanTaskVote is delivered to the waiting workflow through the assignment's awakeable.
+type HumanTaskVote struct {
+	Approver   string    `json:"approver"`
+	OnBehalfOf string    `json:"on_behalf_of,omitempty"`
+	Approved   bool      `json:"approved"`
+	Comment    string    `json:"comment,omitempty"`
+	Escalation bool      `json:"escalation,omitempty"`
+	At         time.Time `json:"at"`
+
+	// Delegations lead from the original approver to the voter
+	Delegations []HumanTaskEvent `json:"delegations,omitempty"`
+}
+
+// HumanTaskDecision is submitted by an assignee to HumanTaskInbox.Decide.
+type HumanTaskDecision struct {
+	TaskKey  string `json:"task_key"`
+	Approved bool   `json:"approved"`
+	Comment  string `json:"comment,omitempty"`
+
+	// Escalation decides the assignment received as escalation manager
+	// rather than as approver, for assignees who hold both
+	Escalation bool `json:"escalation,omitempty"`
+
+	// OnBehalfOf decides an assignment delegated by that approver rather
+	// than the assignee's own
+	OnBehalfOf string `json:"on_behalf_of,omitempty"`
+}
+
+// HumanTaskDelegation hands a task to another assignee.
+type HumanTaskDelegation struct {
+	TaskKey string `json:"task_key"`
+	To      string `json:"to"`
+	Comment string `json:"comment,omitempty"`
+
+	// Escalation and OnBehalfOf select the assignment, as in
+	// HumanTaskDecision
+	Escalation bool   `json:"escalation,omitempty"`
+	OnBehalfOf string `json:"on_behalf_of,omitempty"`
+}
+
+// HumanTaskNotificationKind says why an assignee is being notified.
+type HumanTaskNotificationKind string
+
+const (
+	HumanTaskAssigned  HumanTaskNotificationKind = "assigned"
+	HumanTaskReminder  HumanTaskNotificationKind = "reminder"
+	HumanTaskDelegated HumanTaskNotificationKind = "delegated"
+	HumanTaskEscalated HumanTaskNotificationKind = "escalated"
+)
+
+// HumanTaskNotification is passed to the notifier set with SetHumanTaskNotifier.
+type HumanTaskNotification struct {
+	Kind       HumanTaskNotificationKind `json:"kind"`
+	Assignee   string                    `json:"assignee"`
+	Assignment HumanTaskAssignment       `json:"assignment"`
+}
+
+var (
+	humanTaskNotifierMu sync.RWMutex
+	humanTaskNotifier   func(rc restate.RunContext, n HumanTaskNotification) error
+)
+
+// SetHumanTaskNotifier installs the function HumanTaskInbox uses to reach
+// people (email, chat, ...). It runs inside restate.Run; without one,
+// notifications are only logged.
+func SetHumanTaskNotifier(fn func(rc restate.RunContext, n HumanTaskNotification) error) {
+	humanTaskNotifierMu.Lock()
+	defer humanTaskNotifierMu.Unlock()
+	humanTaskNotifier = fn
+}
+
+// HumanTaskEvent is one entry of a task's decision trail.
+type HumanTaskEvent struct {
+	At         time.Time `json:"at"`
+	Kind       string    `json:"kind"` // assigned, reminded, escalated, delegated, approved, rejected, timed_out
+	Actor      string    `json:"actor,omitempty"`
+	OnBehalfOf string    `json:"on_behalf_of,omitempty"`
+	To         string    `json:"to,omitempty"` // delegated: the new assignee
+	Comment    string    `json:"comment,omitempty"`
+}
+
+// HumanTaskOutcome is the result of AwaitHumanTask.
+type HumanTaskOutcome struct {
+	TaskKey     string           `json:"task_key"`
+	Approved    bool             `json:"approved"`
+	Decided     bool             `json:"decided"`
+	Approvals   int              `json:"approvals"`
+	Rejections  int              `json:"rejections"`
+	EscalatedTo string           `json:"escalated_to,omitempty"`
+	Trail       []HumanTaskEvent `json:"trail"`
+}
+
+// AwaitHumanTask assigns a task to its approvers' inboxes and waits until a
+// quorum approves, the quorum becomes unreachable, an escalation manager
+// decides, or the timeout expires. Reminders and the escalation run on
+// durable timers. In workflow and Virtual Object contexts the outcome,
+// including the decision trail, is also kept in state under
+// "human_task:<ID>".
+func AwaitHumanTask(ctx restate.Context, task HumanTask) (HumanTaskOutcome, error) {
+	if task.ID == "" || len(task.Approvers) == 0 {
+		return HumanTaskOutcome{}, restate.TerminalError(fmt.Errorf("human task needs an id and approvers"), 400)
+	}
+	task.Approvers = dedupeStrings(task.Approvers)
+	if task.Quorum <= 0 {
+		task.Quorum = 1
+	}
+	if task.Quorum > len(task.Approvers) {
+		return HumanTaskOutcome{}, restate.TerminalError(
+			fmt.Errorf("human task %s: quorum %d exceeds %d approvers", task.ID, task.Quorum, len(task.Approvers)), 400)
+	}
+
+	run := &humanTaskRun{ctx: ctx, task: task}
+	run.out.TaskKey = instanceKey(ctx) + "/" + task.ID
+	run.log = ctx.Log().With("task", run.out.TaskKey)
+	for _, a := range task.Approvers {
+		run.assign(a, false)
+	}
+	run.log.Info("human_task.assigned", "approvers", task.Approvers, "quorum", task.Quorum)
+
+	err := run.wait()
+
+	// Whatever the outcome, undecided assignments leave the inboxes
+	for _, slot := range run.pending {
+		ObjectClient[string, restate.Void]{
+			ServiceName: HumanTaskInboxServiceName,
+			HandlerName: "Withdraw",
+		}.Send(ctx, slot.assignee, humanTaskSlotKey(run.out.TaskKey, slot.escalation, slot.assignee))
+	}
+	if kv, ok := ctx.(restate.ObjectContext); ok {
+		restate.Set(kv, "human_task:"+task.ID, run.out)
+	}
+	return run.out, err
+}
+
+// humanTaskRun is the workflow-side state of one AwaitHumanTask call.
+type humanTaskRun struct {
+	ctx     restate.Context
+	log     *slog.Logger
+	task    HumanTask
+	out     HumanTaskOutcome
+	pending []humanTaskSlot
+}
+
+// humanTaskSlot is an assignment whose vote has not arrived.
+type humanTaskSlot struct {
+	assignee   string
+	escalation bool
+	awakeable  restate.AwakeableFuture[HumanTaskVote]
+}
+
+func (r *humanTaskRun) assign(assignee string, escalation bool) {
+	aw := restate.Awakeable[HumanTaskVote](r.ctx)
+	r.pending = append(r.pending, humanTaskSlot{assignee: assignee, escalation: escalation, awakeable: aw})
+	ObjectClient[HumanTaskAssignment, restate.Void]{
+		ServiceName: HumanTaskInboxServiceName,
+		HandlerName: "Assign",
+	}.Send(r.ctx, assignee, HumanTaskAssignment{
+		TaskKey:     r.out.TaskKey,
+		Title:       r.task.Title,
+		Description: r.task.Description,
+		AwakeableID: aw.Id(),
+		Escalation:  escalation,
+	})
+	kind := "assigned"
+	if escalation {
+		kind = "escalated"
+	}
+	r.trail(HumanTaskEvent{Kind: kind, Actor: assignee})
+}
+
+func (r *humanTaskRun) trail(ev HumanTaskEvent) {
+	if ev.At.IsZero() {
+		ev.At, _ = humanTaskNow(r.ctx)
+	}
+	r.out.Trail = append(r.out.Trail, ev)
+}
+
+// wait races the pending votes against the next reminder, escalation or
+// timeout deadline until the task is decided. Each round is the same race
+// RaceAwakeableWithTimeout runs for a single approval.
+func (r *humanTaskRun) wait() error {
+	now, err := humanTaskNow(r.ctx)
+	if err != nil {
+		return err
+	}
+	var remindAt, escalateAt, timeoutAt time.Time
+	if r.task.ReminderEvery > 0 {
+		remindAt = now.Add(r.task.ReminderEvery)
+	}
+	if r.task.EscalateTo != "" && r.task.EscalateAfter > 0 {
+		escalateAt = now.Add(r.task.EscalateAfter)
+	}
+	if r.task.Timeout > 0 {
+		timeoutAt = now.Add(r.task.Timeout)
+	}
+
+	for {
+		next := time.Time{}
+		for _, at := range []time.Time{timeoutAt, escalateAt, remindAt} {
+			if !at.IsZero() && (next.IsZero() || at.Before(next)) {
+				next = at
+			}
+		}
+		var timer restate.AfterFuture
+		if !next.IsZero() {
+			d := next.Sub(now)
+			if d < 0 {
+				d = 0
+			}
+			timer = restate.After(r.ctx, d)
+		}
+		awakeables := make([]restate.AwakeableFuture[HumanTaskVote], len(r.pending))
+		for i, slot := range r.pending {
+			awakeables[i] = slot.awakeable
+		}
+
+		idx, vote, timedOut, err := raceAwakeables(r.ctx, awakeables, timer)
+		if err != nil {
+			return err
+		}
+
+		if timedOut {
+			now = next
+			switch {
+			case next.Equal(timeoutAt):
+				r.trail(HumanTaskEvent{Kind: "timed_out"})
+				r.log.Warn("human_task.timed_out", "approvals", r.out.Approvals, "rejections", r.out.Rejections)
+				return restate.TerminalError(fmt.Errorf("human task %s undecided after %v", r.task.ID, r.task.Timeout), 408)
+			case next.Equal(escalateAt):
+				escalateAt = time.Time{}
+				r.out.EscalatedTo = r.task.EscalateTo
+				r.log.Warn("human_task.escalated", "to", r.task.EscalateTo)
+				r.assign(r.task.EscalateTo, true)
+			default:
+				for _, slot := range r.pending {
+					ObjectClient[string, restate.Void]{
+						ServiceName: HumanTaskInboxServiceName,
+						HandlerName: "Remind",
+					}.Send(r.ctx, slot.assignee, humanTaskSlotKey(r.out.TaskKey, slot.escalation, slot.assignee))
+					r.trail(HumanTaskEvent{Kind: "reminded", Actor: slot.assignee})
+				}
+				remindAt = remindAt.Add(r.task.ReminderEvery)
+			}
+			continue
+		}
+
+		slot := r.pending[idx]
+		r.pending = removeIndex(r.pending, idx)
+		if r.count(slot, vote) {
+			r.log.Info("human_task.decided", "approved", r.out.Approved,
+				"approvals", r.out.Approvals, "rejections", r.out.Rejections)
+			return nil
+		}
+		if now, err = humanTaskNow(r.ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// count records a vote, preceded by the delegations that led to it, and
+// reports whether it decided the task.
+func (r *humanTaskRun) count(slot humanTaskSlot, vote HumanTaskVote) bool {
+	kind := "rejected"
+	if vote.Approved {
+		kind = "approved"
+		r.out.Approvals++
+	} else {
+		r.out.Rejections++
 	}
+	for _, ev := range vote.Delegations {
+		r.trail(ev)
+	}
+	r.trail(HumanTaskEvent{
+		At: vote.At, Kind: kind, Actor: vote.Approver, OnBehalfOf: vote.OnBehalfOf, Comment: vote.Comment,
+	})
+	r.log.Info("human_task.vote", "approver", vote.Approver, "approved", vote.Approved, "escalation", slot.escalation)
 
-	ctx.Log().Info("controlplane.approval_result", "approval_id", approvalID, "approved", result)
-	return result, nil
+	remaining, managerPending := 0, false
+	for _, q := range r.pending {
+		if q.escalation {
+			managerPending = true
+		} else {
+			remaining++
+		}
+	}
+	switch {
+	case slot.escalation:
+		r.out.Decided, r.out.Approved = true, vote.Approved
+	case r.out.Approvals >= r.task.Quorum:
+		r.out.Decided, r.out.Approved = true, true
+	case r.out.Approvals+remaining < r.task.Quorum && !managerPending:
+		// Quorum unreachable and no manager left to overrule
+		r.out.Decided = true
+	}
+	return r.out.Decided
 }
 
-// GenerateIdempotencyKey creates a deterministic idempotency key for external calls.
-// Uses restate.UUID to ensure deterministic generation across retries.
-// IMPORTANT: Must be called from within a durable handler context.
-func (cp *ControlPlaneService) GenerateIdempotencyKey(ctx restate.Context, suffix string) string {
-	// Use deterministic UUID seeded by invocation ID
-	uuid := restate.UUID(ctx)
-	return fmt.Sprintf("%s:%s:%s", cp.idempotencyPrefix, suffix, uuid.String())
+// AwaitHumanTask runs a multi-approver task from an orchestrator.
+func (cp *ControlPlaneService) AwaitHumanTask(ctx restate.Context, task HumanTask) (HumanTaskOutcome, error) {
+	return AwaitHumanTask(ctx, task)
 }
 
-// GenerateIdempotencyKeyDeterministic creates an idempotency key using only deterministic inputs.
-// Use this when you need a predictable key based on business data (e.g., user ID + order ID).
-func (cp *ControlPlaneService) GenerateIdempotencyKeyDeterministic(businessKeys ...string) string {
-	if len(businessKeys) == 0 {
-		return cp.idempotencyPrefix
+// HumanTaskInbox is a Virtual Object, keyed by assignee, holding the tasks
+// waiting for that person. UIs list it and submit decisions and delegations.
+//
+//	server.Bind(restate.Reflect(framework.HumanTaskInbox{}))
+type HumanTaskInbox struct{}
+
+const (
+	humanTaskPendingKey   = "pending"
+	humanTaskForwardedKey = "forwarded"
+)
+
+// humanTaskSlotKey keys an inbox entry by task, role and the approver it
+// was first assigned to. An approver who is also the task's escalation
+// manager holds both assignments at once, and one delegated by another
+// approver of the same task sits next to their own. The key stays the same
+// through delegations; Remind and Withdraw take it.
+func humanTaskSlotKey(taskKey string, escalation bool, principal string) string {
+	role := "approver"
+	if escalation {
+		role = "escalation"
 	}
-	// Join all keys with deterministic separator
-	combined := fmt.Sprintf("%s:%s", cp.idempotencyPrefix, path.Join(businessKeys...))
-	return combined
+	return taskKey + "/" + role + "/" + principal
 }
 
-// SafeStep enforces "register compensation BEFORE action" pattern
-type SafeStep[T any] struct {
-	saga         *SagaFramework
-	name         string
-	compensation SagaCompensationFunc
-	registered   bool
-	executed     bool
+// humanTaskPrincipal is the approver an assignment was first made to.
+func humanTaskPrincipal(onBehalfOf, assignee string) string {
+	if onBehalfOf != "" {
+		return onBehalfOf
+	}
+	return assignee
 }
 
-// NewSafeStep creates a step that enforces compensation-before-action
-func (s *SagaFramework) NewSafeStep(name string) *SafeStep[any] {
-	return &SafeStep[any]{
-		saga: s,
-		name: name,
+// Assign adds a task and notifies the assignee.
+func (HumanTaskInbox) Assign(ctx restate.ObjectContext, a HumanTaskAssignment) (restate.Void, error) {
+	pending, err := restate.Get[map[string]HumanTaskAssignment](ctx, humanTaskPendingKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	if pending == nil {
+		pending = make(map[string]HumanTaskAssignment)
+	}
+	now, err := humanTaskNow(ctx)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	a.AssignedAt = now
+	slotKey := humanTaskSlotKey(a.TaskKey, a.Escalation, humanTaskPrincipal(a.OnBehalfOf, restate.Key(ctx)))
+	pending[slotKey] = a
+	restate.Set(ctx, humanTaskPendingKey, pending)
+
+	// A task delegated back to this inbox is no longer forwarded from it
+	forwarded, err := restate.Get[map[string]string](ctx, humanTaskForwardedKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	if _, ok := forwarded[slotKey]; ok {
+		delete(forwarded, slotKey)
+		restate.Set(ctx, humanTaskForwardedKey, forwarded)
+	}
+
+	kind := HumanTaskAssigned
+	switch {
+	case a.Escalation:
+		kind = HumanTaskEscalated
+	case a.DelegatedBy != "":
+		kind = HumanTaskDelegated
 	}
+	return restate.Void{}, notifyHumanTask(ctx, kind, a)
 }
 
-// WithCompensation registers the compensation (MUST be called before Execute)
-func (step *SafeStep[T]) WithCompensation(compensation SagaCompensationFunc) *SafeStep[T] {
-	if step.executed {
-		panic(fmt.Sprintf("saga: cannot register compensation after action execution: %s", step.name))
+// Remind re-notifies the assignee, following delegations.
+func (HumanTaskInbox) Remind(ctx restate.ObjectContext, slotKey string) (restate.Void, error) {
+	pending, err := restate.Get[map[string]HumanTaskAssignment](ctx, humanTaskPendingKey)
+	if err != nil {
+		return restate.Void{}, err
 	}
-	step.compensation = compensation
-	step.registered = true
-	return step
+	a, ok := pending[slotKey]
+	if !ok {
+		return restate.Void{}, forwardHumanTask(ctx, slotKey, "Remind")
+	}
+	a.Reminders++
+	pending[slotKey] = a
+	restate.Set(ctx, humanTaskPendingKey, pending)
+	return restate.Void{}, notifyHumanTask(ctx, HumanTaskReminder, a)
 }
 
-// Execute runs the action (compensation must be registered first)
-func (step *SafeStep[T]) Execute(
-	ctx restate.Context,
-	action func() (T, error),
-) (T, error) {
-	var zero T
+// Decide records the assignee's vote and hands it to the waiting workflow.
+func (HumanTaskInbox) Decide(ctx restate.ObjectContext, d HumanTaskDecision) (restate.Void, error) {
+	pending, err := restate.Get[map[string]HumanTaskAssignment](ctx, humanTaskPendingKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	slotKey := humanTaskSlotKey(d.TaskKey, d.Escalation, humanTaskPrincipal(d.OnBehalfOf, restate.Key(ctx)))
+	a, ok := pending[slotKey]
+	if !ok {
+		return restate.Void{}, restate.TerminalError(fmt.Errorf("task %s is not pending for %s", slotKey, restate.Key(ctx)), 404)
+	}
+	now, err := humanTaskNow(ctx)
+	if err != nil {
+		return restate.Void{}, err
+	}
 
-	if !step.registered {
-		return zero, restate.TerminalError(
-			fmt.Errorf("saga: must register compensation before executing action: %s", step.name),
-			500,
-		)
+	vote := HumanTaskVote{
+		Approver:    restate.Key(ctx),
+		Approved:    d.Approved,
+		Comment:     d.Comment,
+		Escalation:  a.Escalation,
+		At:          now,
+		Delegations: a.Delegations,
 	}
+	if a.OnBehalfOf != restate.Key(ctx) {
+		vote.OnBehalfOf = a.OnBehalfOf
+	}
+	restate.ResolveAwakeable(ctx, a.AwakeableID, vote)
+	delete(pending, slotKey)
+	restate.Set(ctx, humanTaskPendingKey, pending)
+	ctx.Log().Info("human_task.decided", "task", d.TaskKey, "approver", restate.Key(ctx), "approved", d.Approved)
+	return restate.Void{}, nil
+}
 
-	if step.executed {
-		return zero, restate.TerminalError(
-			fmt.Errorf("saga: action already executed: %s", step.name),
-			500,
-		)
+// Delegate moves a task to another assignee, who then votes on behalf of
+// the original approver. The delegation reaches the task's trail with the
+// vote.
+func (HumanTaskInbox) Delegate(ctx restate.ObjectContext, d HumanTaskDelegation) (restate.Void, error) {
+	if d.To == "" || d.To == restate.Key(ctx) {
+		return restate.Void{}, restate.TerminalError(fmt.Errorf("delegate to another assignee"), 400)
+	}
+	pending, err := restate.Get[map[string]HumanTaskAssignment](ctx, humanTaskPendingKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	slotKey := humanTaskSlotKey(d.TaskKey, d.Escalation, humanTaskPrincipal(d.OnBehalfOf, restate.Key(ctx)))
+	a, ok := pending[slotKey]
+	if !ok {
+		return restate.Void{}, restate.TerminalError(fmt.Errorf("task %s is not pending for %s", slotKey, restate.Key(ctx)), 404)
+	}
+	forwarded, err := restate.Get[map[string]string](ctx, humanTaskForwardedKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	if forwarded == nil {
+		forwarded = make(map[string]string)
+	}
+	now, err := humanTaskNow(ctx)
+	if err != nil {
+		return restate.Void{}, err
 	}
 
-	// Register compensation first using the saga's Register method
-	step.saga.Register(step.name, func(rc restate.RunContext, payload []byte) error {
-		return step.compensation(rc, payload)
+	a.OnBehalfOf = humanTaskPrincipal(a.OnBehalfOf, restate.Key(ctx))
+	a.DelegatedBy = restate.Key(ctx)
+	a.Reminders = 0
+	a.Delegations = append(a.Delegations, HumanTaskEvent{
+		At: now, Kind: "delegated", Actor: restate.Key(ctx), OnBehalfOf: a.OnBehalfOf, To: d.To, Comment: d.Comment,
 	})
+	if d.Comment != "" {
+		a.Description = strings.TrimSpace(a.Description + "\n\nDelegated by " + restate.Key(ctx) + ": " + d.Comment)
+	}
+	ObjectClient[HumanTaskAssignment, restate.Void]{
+		ServiceName: HumanTaskInboxServiceName,
+		HandlerName: "Assign",
+	}.Send(ctx, d.To, a)
 
-	// Then execute action
-	result, err := restate.Run(step.saga.wctx, func(rc restate.RunContext) (T, error) {
-		return action()
-	}, restate.WithName(step.name))
+	delete(pending, slotKey)
+	forwarded[slotKey] = d.To
+	restate.Set(ctx, humanTaskPendingKey, pending)
+	restate.Set(ctx, humanTaskForwardedKey, forwarded)
+	ctx.Log().Info("human_task.delegated", "task", d.TaskKey, "from", restate.Key(ctx), "to", d.To)
+	return restate.Void{}, nil
+}
 
-	step.executed = true
+// Withdraw removes a task that no longer needs this assignee, following delegations.
+func (HumanTaskInbox) Withdraw(ctx restate.ObjectContext, slotKey string) (restate.Void, error) {
+	pending, err := restate.Get[map[string]HumanTaskAssignment](ctx, humanTaskPendingKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	if _, ok := pending[slotKey]; ok {
+		delete(pending, slotKey)
+		restate.Set(ctx, humanTaskPendingKey, pending)
+		return restate.Void{}, nil
+	}
+	if err := forwardHumanTask(ctx, slotKey, "Withdraw"); err != nil {
+		return restate.Void{}, err
+	}
+	forwarded, err := restate.Get[map[string]string](ctx, humanTaskForwardedKey)
+	if err != nil {
+		return restate.Void{}, err
+	}
+	delete(forwarded, slotKey)
+	restate.Set(ctx, humanTaskForwardedKey, forwarded)
+	return restate.Void{}, nil
+}
 
+// List returns the pending tasks, oldest first.
+func (HumanTaskInbox) List(ctx restate.ObjectSharedContext) ([]HumanTaskAssignment, error) {
+	pending, err := restate.Get[map[string]HumanTaskAssignment](ctx, humanTaskPendingKey)
 	if err != nil {
-		// Error will trigger compensation automatically
-		return zero, err
+		return nil, err
+	}
+	list := make([]HumanTaskAssignment, 0, len(pending))
+	for _, a := range pending {
+		list = append(list, a)
 	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AssignedAt.Before(list[j].AssignedAt) })
+	return list, nil
+}
 
-	return result, nil
+// forwardHumanTask relays a call for a task this inbox delegated.
+func forwardHumanTask(ctx restate.ObjectContext, slotKey, handler string) error {
+	forwarded, err := restate.Get[map[string]string](ctx, humanTaskForwardedKey)
+	if err != nil {
+		return err
+	}
+	if to, ok := forwarded[slotKey]; ok {
+		ObjectClient[string, restate.Void]{
+			ServiceName: HumanTaskInboxServiceName,
+			HandlerName: handler,
+		}.Send(ctx, to, slotKey)
+	}
+	return nil
 }
 
-// CompensationStrategy defines how to handle partial compensation
-type CompensationStrategy int
+func humanTaskNow(ctx restate.Context) (time.Time, error) {
+	return RunDo(ctx, func(rc restate.RunContext) (time.Time, error) {
+		return time.Now(), nil
+	}, restate.WithName("human_task.now"))
+}
+
+func notifyHumanTask(ctx restate.ObjectContext, kind HumanTaskNotificationKind, a HumanTaskAssignment) error {
+	humanTaskNotifierMu.RLock()
+	notify := humanTaskNotifier
+	humanTaskNotifierMu.RUnlock()
+
+	ctx.Log().Info("human_task.notify", "kind", kind, "assignee", restate.Key(ctx), "task", a.TaskKey)
+	if notify == nil {
+		return nil
+	}
+	n := HumanTaskNotification{Kind: kind, Assignee: restate.Key(ctx), Assignment: a}
+	return RunDoVoid(ctx, func(rc restate.RunContext) error {
+		return notify(rc, n)
+	}, restate.WithName("human_task.notify"))
+}
+
+// -----------------------------------------------------------------------------
+// Section 5B: Child Workflows
+// -----------------------------------------------------------------------------
+
+// ChildWorkflowsServiceName is the service that cancels child workflows
+// when a saga compensates the step that spawned them.
+const ChildWorkflowsServiceName = "ChildWorkflows"
+
+// childCancelStep is the saga step recorded for every spawned child. It is
+// bookkeeping, so it stays out of the progress tracker.
+const childCancelStep = "child_workflow.cancel"
+
+// ChildFailurePolicy decides how AwaitAll reacts to a failed child.
+type ChildFailurePolicy string
 
 const (
-	// CompensateAll runs all compensations (default, all-or-nothing)
-	CompensateAll CompensationStrategy = iota
+	// ChildFailFast cancels the remaining children on the first failure
+	ChildFailFast ChildFailurePolicy = "fail_fast"
 
-	// CompensateCompleted only compensates successfully completed steps
-	CompensateCompleted
+	// ChildCollect waits for every child and reports all failures together
+	ChildCollect ChildFailurePolicy = "collect"
+)
 
-	// CompensateBestEffort tries all compensations, continues on errors
-	CompensateBestEffort
+// ChildStatus is the last known state of a child workflow.
+type ChildStatus string
 
-	// CompensateUntilSuccess stops after first successful compensation
-	CompensateUntilSuccess
+const (
+	ChildRunning   ChildStatus = "running"
+	ChildSucceeded ChildStatus = "succeeded"
+	ChildFailed    ChildStatus = "failed"
+	ChildCancelled ChildStatus = "cancelled"
 )
 
-// PartialCompensationConfig configures partial compensation behavior
-type PartialCompensationConfig struct {
-	Strategy        CompensationStrategy
-	ContinueOnError bool
-	MaxRetries      int
+// ChildRef identifies a spawned child workflow. It is persisted in the
+// parent's state and is the payload of the child's saga compensation.
+type ChildRef struct {
+	Name         string      `json:"name"`
+	ServiceName  string      `json:"serviceName"`
+	WorkflowID   string      `json:"workflowId"`
+	InvocationID string      `json:"invocationId"`
+	Status       ChildStatus `json:"status"`
+	Error        string      `json:"error,omitempty"`
+
+	// Output is the result of a succeeded child, kept so settled children
+	// are never called again
+	Output json.RawMessage `json:"output,omitempty"`
 }
 
-// SetCompensationStrategy configures how compensations are executed
-func (s *SagaFramework) SetCompensationStrategy(strategy CompensationStrategy) {
-	// Store strategy in saga namespace state
-	restate.Set(s.wctx, fmt.Sprintf("%s:strategy", s.nsKey), int(strategy))
+// ChildResult is the outcome of one child.
+type ChildResult[O any] struct {
+	Ref    ChildRef
+	Output O
+	Err    error
 }
 
-// RollbackWithStrategy executes compensations with the specified strategy
-// Simplified version that works with existing saga implementation
-func (s *SagaFramework) RollbackWithStrategy(
-	ctx restate.WorkflowContext,
-	strategy CompensationStrategy,
-) error {
-	// Get compensation entries
-	entries, err := restate.Get[[]SagaEntry](ctx, s.nsKey)
-	if err != nil || len(entries) == 0 {
-		s.log.Info("saga: no compensations to execute")
-		return nil
+// Children spawns and tracks a group of typed child workflows from a
+// workflow or Virtual Object handler. Child IDs derive from the parent key,
+// the group and the child name, so a replayed or retried parent addresses
+// the same children, and the child list lives in parent state.
+//
+//	children, err := framework.NewChildren(ctx, "shipments", shipmentClient)
+//	if err != nil {
+//	    return err
+//	}
+//	children.WithSaga(saga)
+//	for _, parcel := range order.Parcels {
+//	    if _, err := children.Spawn(parcel.ID, parcel); err != nil {
+//	        return err
+//	    }
+//	}
+//	results, err := children.AwaitAll(framework.ChildFailFast)
+//
+// Children still running are cancelled when the parent is cancelled while
+// awaiting them, when a fail-fast wait fails, and, with WithSaga, when the
+// saga compensates.
+type Children[I, O any] struct {
+	ctx    restate.ObjectContext
+	group  string
+	client WorkflowClient[I, O]
+	saga   *SagaFramework
+	refs   []ChildRef
+}
+
+// NewChildren loads the children of group already spawned by this parent.
+func NewChildren[I, O any](ctx restate.ObjectContext, group string, client WorkflowClient[I, O]) (*Children[I, O], error) {
+	if group == "" {
+		return nil, restate.TerminalError(fmt.Errorf("child workflow group is required"), 400)
+	}
+	refs, err := restate.Get[[]ChildRef](ctx, childrenStateKey(group))
+	if err != nil {
+		return nil, err
 	}
+	return &Children[I, O]{ctx: ctx, group: group, client: client, refs: refs}, nil
+}
 
-	s.log.Info("saga: starting compensations",
-		"count", len(entries),
-		"strategy", strategyName(strategy))
+func childrenStateKey(group string) string {
+	return "children:" + group
+}
 
-	// Execute compensations in reverse order
-	var compensationErrors []error
+// WithSaga records a cancellation step in saga for every child spawned from
+// now on, so compensating the saga cancels them. Bind ChildWorkflows next
+// to the parent for the compensation to reach.
+func (c *Children[I, O]) WithSaga(saga *SagaFramework) *Children[I, O] {
+	saga.RegisterRemote(childCancelStep, SagaHandlerRef{
+		ServiceName: ChildWorkflowsServiceName,
+		HandlerName: "Cancel",
+	})
+	c.saga = saga
+	return c
+}
 
-	for idx := len(entries) - 1; idx >= 0; idx-- {
-		entry := entries[idx]
+// Spawn starts the child called name. Spawning a name that already exists
+// in the group returns its reference without starting it again.
+func (c *Children[I, O]) Spawn(name string, input I, opts ...CallOption) (ChildRef, error) {
+	if name == "" {
+		return ChildRef{}, restate.TerminalError(fmt.Errorf("child workflow name is required"), 400)
+	}
+	for _, ref := range c.refs {
+		if ref.Name == name {
+			return ref, nil
+		}
+	}
 
-		handler, ok := s.registry[entry.Name]
-		if !ok {
-			s.log.Warn("saga: no compensation handler", "name", entry.Name)
-			if strategy != CompensateBestEffort {
-				return fmt.Errorf("missing compensation handler: %s", entry.Name)
+	id := fmt.Sprintf("%s:%s:%s", restate.Key(c.ctx), c.group, name)
+	inv := c.client.Submit(c.ctx, id, input, opts...)
+	ref := ChildRef{
+		Name:         name,
+		ServiceName:  c.client.ServiceName,
+		WorkflowID:   id,
+		InvocationID: inv.GetInvocationId(),
+		Status:       ChildRunning,
+	}
+	c.refs = append(c.refs, ref)
+	c.persist()
+	c.ctx.Log().Info("children: spawned", "group", c.group, "name", name, "workflow_id", id)
+
+	if c.saga != nil {
+		// The send is journaled, so the step is recorded after it: the
+		// invocation ID only exists once the child was started
+		if err := c.saga.Add(childCancelStep, ref, true); err != nil {
+			return ref, err
+		}
+		if err := c.saga.MarkCompleted(childCancelStep); err != nil {
+			return ref, err
+		}
+	}
+	return ref, nil
+}
+
+// List returns the children spawned so far, in spawn order.
+func (c *Children[I, O]) List() []ChildRef {
+	return append([]ChildRef(nil), c.refs...)
+}
+
+// AwaitAll waits for every child still running and returns the results of
+// all children in spawn order; children that settled earlier are answered
+// from parent state. Under ChildFailFast the first failure cancels the
+// remaining children and fails with a terminal error; under ChildCollect
+// the error joins every failure and the results are complete. Failures are
+// terminal, so a parent returning the error is not retried against
+// children that already settled.
+func (c *Children[I, O]) AwaitAll(policy ChildFailurePolicy) ([]ChildResult[O], error) {
+	results := make([]ChildResult[O], len(c.refs))
+	var indexes []int
+	var failures []error
+	for idx, ref := range c.refs {
+		results[idx].Ref = ref
+		switch ref.Status {
+		case ChildRunning:
+			indexes = append(indexes, idx)
+		case ChildCancelled:
+			results[idx].Err = fmt.Errorf("child %s was cancelled", ref.Name)
+		case ChildFailed:
+			// Settled for good, so the parent must not retry against it
+			results[idx].Err = restate.TerminalError(errors.New(ref.Error), 500)
+			failures = append(failures, restate.TerminalError(fmt.Errorf("child %s failed: %s", ref.Name, ref.Error), 500))
+		case ChildSucceeded:
+			if len(ref.Output) > 0 {
+				if err := json.Unmarshal(ref.Output, &results[idx].Output); err != nil {
+					results[idx].Err = fmt.Errorf("decode output of child %s: %w", ref.Name, err)
+				}
 			}
-			continue
 		}
+	}
+	if len(failures) > 0 && policy == ChildFailFast {
+		indexes = nil
+	}
 
-		s.log.Info("saga: executing compensation",
-			"step", entry.Name,
-			"strategy", strategyName(strategy))
-
-		_, runErr := restate.Run(ctx, func(rc restate.RunContext) (restate.Void, error) {
-			return restate.Void{}, handler(rc, entry.Payload)
-		}, restate.WithName(fmt.Sprintf("compensate-%s", entry.Name)))
-
-		if runErr != nil {
-			compensationErrors = append(compensationErrors,
-				fmt.Errorf("compensation failed for %s: %w", entry.Name, runErr))
+	err := c.await(indexes, func(idx int, out O, childErr error) bool {
+		results[idx] = ChildResult[O]{Ref: c.refs[idx], Output: out, Err: childErr}
+		if childErr == nil {
+			return true
+		}
+		failures = append(failures, fmt.Errorf("child %s failed: %w", c.refs[idx].Name, childErr))
+		return policy != ChildFailFast
+	})
+	if err != nil {
+		return results, err
+	}
 
-			// Handle error based on strategy
-			if strategy == CompensateBestEffort {
-				// Continue with next compensation
-				s.log.Warn("saga: compensation failed, continuing",
-					"step", entry.Name,
-					"error", runErr.Error())
-				continue
-			} else if strategy != CompensateUntilSuccess {
-				// Stop on error for other strategies
-				break
-			}
-		} else {
-			// Compensation succeeded
-			// Remove from list
-			entries = removeIndex(entries, idx)
-			restate.Set(ctx, s.nsKey, entries)
+	if len(failures) > 0 && policy == ChildFailFast {
+		c.Cancel()
+		for idx := range results {
+			results[idx].Ref = c.refs[idx]
+		}
+		return results, restate.TerminalError(failures[0], 500)
+	}
+	return results, errors.Join(failures...)
+}
 
-			if strategy == CompensateUntilSuccess {
-				// Stop after first success
-				break
-			}
+// AwaitAny waits for the first running child to finish and returns its
+// result. The error is non-nil only when waiting itself failed; a failed
+// child is reported through ChildResult.Err.
+func (c *Children[I, O]) AwaitAny() (ChildResult[O], error) {
+	var indexes []int
+	for idx, ref := range c.refs {
+		if ref.Status == ChildRunning {
+			indexes = append(indexes, idx)
 		}
 	}
+	if len(indexes) == 0 {
+		return ChildResult[O]{}, restate.TerminalError(fmt.Errorf("no running children in group %s", c.group), 404)
+	}
 
-	if len(compensationErrors) > 0 && strategy != CompensateBestEffort {
-		return fmt.Errorf("saga rollback encountered %d errors: %v",
-			len(compensationErrors), compensationErrors[0])
+	var first ChildResult[O]
+	err := c.await(indexes, func(idx int, out O, childErr error) bool {
+		first = ChildResult[O]{Ref: c.refs[idx], Output: out, Err: childErr}
+		return false
+	})
+	return first, err
+}
+
+// Cancel cancels every child still running.
+func (c *Children[I, O]) Cancel() {
+	cancelled := 0
+	for idx := range c.refs {
+		if c.refs[idx].Status != ChildRunning {
+			continue
+		}
+		restate.CancelInvocation(c.ctx, c.refs[idx].InvocationID)
+		c.refs[idx].Status = ChildCancelled
+		cancelled++
+	}
+	if cancelled > 0 {
+		c.persist()
+		c.ctx.Log().Info("children: cancelled", "group", c.group, "count", cancelled)
+	}
+}
+
+// await attaches to the running children at indexes and hands each outcome
+// to settle as it completes, until settle returns false or all are done.
+// Only running children are attached: the run handler is called again to
+// attach, which for a child past its retention would start a new instance.
+// A failed wait means the parent is being cancelled, so the children still
+// running are cancelled with it.
+func (c *Children[I, O]) await(indexes []int, settle func(idx int, out O, err error) bool) error {
+	futures := make([]restate.Future, len(indexes))
+	typed := make([]restate.ResponseFuture[O], len(indexes))
+	for n, idx := range indexes {
+		ref := c.refs[idx]
+		var zero I
+		typed[n] = restate.Workflow[O](c.ctx, ref.ServiceName, ref.WorkflowID, c.client.HandlerName).RequestFuture(zero)
+		futures[n] = typed[n]
+	}
+
+	for len(futures) > 0 {
+		winner, err := restate.WaitFirst(c.ctx, futures...)
+		if err != nil {
+			c.ctx.Log().Warn("children: parent wait failed, cancelling children", "group", c.group, "error", err.Error())
+			c.Cancel()
+			return err
+		}
+		n := futureIndex(futures, winner)
+		if n < 0 {
+			continue
+		}
+		idx := indexes[n]
+		out, childErr := typed[n].Response()
+		futures, typed, indexes = removeIndex(futures, n), removeIndex(typed, n), removeIndex(indexes, n)
+
+		switch {
+		case childErr == nil:
+			c.refs[idx].Status, c.refs[idx].Error = ChildSucceeded, ""
+			if raw, err := json.Marshal(out); err == nil {
+				c.refs[idx].Output = raw
+			}
+		case c.refs[idx].Status == ChildCancelled:
+			c.refs[idx].Error = childErr.Error()
+		default:
+			c.refs[idx].Status, c.refs[idx].Error = ChildFailed, childErr.Error()
+		}
+		c.persist()
+		if !settle(idx, out, childErr) {
+			return nil
+		}
 	}
-
 	return nil
 }
 
-// Helper function to get strategy name for logging
-func strategyName(strategy CompensationStrategy) string {
-	switch strategy {
-	case CompensateAll:
-		return "compensate-all"
-	case CompensateCompleted:
-		return "compensate-completed"
-	case CompensateBestEffort:
-		return "compensate-best-effort"
-	case CompensateUntilSuccess:
-		return "compensate-until-success"
-	default:
-		return "unknown"
+func (c *Children[I, O]) persist() {
+	restate.Set(c.ctx, childrenStateKey(c.group), c.refs)
+}
+
+// ChildWorkflows is a Service that cancels child workflows for sagas that
+// compensate a Children group.
+//
+//	server.Bind(restate.Reflect(framework.ChildWorkflows{}))
+type ChildWorkflows struct{}
+
+// Cancel cancels the child's invocation. Cancelling a child that already
+// finished has no effect.
+func (ChildWorkflows) Cancel(ctx restate.Context, ref ChildRef) (restate.Void, error) {
+	if ref.InvocationID == "" {
+		return restate.Void{}, restate.TerminalError(fmt.Errorf("child %s has no invocation id", ref.WorkflowID), 400)
 	}
+	restate.CancelInvocation(ctx, ref.InvocationID)
+	ctx.Log().Info("children: cancelled by compensation", "workflow_id", ref.WorkflowID)
+	return restate.Void{}, nil
 }
 
 // -----------------------------------------------------------------------------
@@ -1388,6 +8078,344 @@ func (dp *DataPlaneService[I, O]) Execute(ctx restate.Context, input I) (O, erro
 // Section 6A: Run (Side Effects) Utilities
 // -----------------------------------------------------------------------------
 
+// RetryPolicy is the backoff schedule shared by RunWithRetry,
+// WorkflowLoop.RetryWithPolicy, the workflow builder and the saga's
+// compensation and forward loops.
+//
+// Delays grow from InitialDelay by Multiplier up to MaxDelay. Jitter is
+// drawn from restate.Rand, which is seeded by the invocation, so a replay
+// computes exactly the delays the original execution slept for.
+//
+//	policy := framework.RetryPolicy{
+//	    MaxAttempts:  8,
+//	    InitialDelay: 200 * time.Millisecond,
+//	    MaxDelay:     time.Minute,
+//	    Jitter:       0.3,
+//	    MaxElapsed:   10 * time.Minute,
+//	    AbortOn:      func(err error) bool { return errors.Is(err, ErrCardDeclined) },
+//	    Classes: []framework.RetryClass{
+//	        {Name: "rate_limited", Match: isRateLimited, InitialDelay: 5 * time.Second},
+//	    },
+//	}
+type RetryPolicy struct {
+	// MaxAttempts bounds the total number of attempts, the first included.
+	// Zero or negative leaves attempts unbounded; MaxElapsed still applies.
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+
+	// Multiplier scales the delay after every failure; values below 1 mean 2
+	Multiplier float64
+
+	// Jitter shortens each delay by a random fraction of at most Jitter
+	// (0..1), spreading out retries of workflows that failed together
+	Jitter float64
+
+	// MaxElapsed stops retrying once the next attempt would start more than
+	// this long after the first one. Zero means no limit.
+	MaxElapsed time.Duration
+
+	// RetryOn decides which errors are retried. Nil retries every
+	// non-terminal error.
+	RetryOn func(error) bool
+
+	// AbortOn stops retrying immediately and takes precedence over RetryOn
+	AbortOn func(error) bool
+
+	// Classes give matching errors their own delays; the first match wins
+	Classes []RetryClass
+}
+
+// RetryClass overrides the delays of one class of errors, e.g. a longer
+// wait for rate limiting than for a dropped connection. Zero fields keep
+// the policy's value.
+type RetryClass struct {
+	Name         string
+	Match        func(error) bool
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// Retryable reports whether err may be retried at all under the policy.
+func (p RetryPolicy) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var failed *attemptError
+	if errors.As(err, &failed) {
+		return failed.outcome.Retryable
+	}
+	if p.AbortOn != nil && p.AbortOn(err) {
+		return false
+	}
+	if p.RetryOn != nil {
+		return p.RetryOn(err)
+	}
+	return !isTerminalError(err)
+}
+
+// Backoff returns the delay before the next attempt once attempt attempts
+// have failed with err, without jitter.
+func (p RetryPolicy) Backoff(err error, attempt int) time.Duration {
+	var failed *attemptError
+	if errors.As(err, &failed) && failed.outcome.Backoff > 0 {
+		return failed.outcome.Backoff
+	}
+	initial, max := p.InitialDelay, p.MaxDelay
+	if class := p.class(err); class != nil {
+		if class.InitialDelay > 0 {
+			initial = class.InitialDelay
+		}
+		if class.MaxDelay > 0 {
+			max = class.MaxDelay
+		}
+	}
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if max <= 0 {
+		max = 5 * time.Minute
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if math.IsInf(delay, 0) || math.IsNaN(delay) || delay >= float64(max) {
+		return max
+	}
+	return time.Duration(delay)
+}
+
+// Delay returns Backoff with the policy's jitter applied. The random draw
+// comes from restate.Rand, so it is identical on replay; policies without
+// jitter draw nothing.
+func (p RetryPolicy) Delay(ctx restate.Context, err error, attempt int) time.Duration {
+	return p.jitter(ctx, p.Backoff(err, attempt))
+}
+
+// jitter shortens delay by the policy's random fraction.
+func (p RetryPolicy) jitter(ctx restate.Context, delay time.Duration) time.Duration {
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay -= time.Duration(float64(delay) * jitter * restate.Rand(ctx).Float64())
+	}
+	return delay
+}
+
+// Next decides whether to retry after attempt attempts have failed, the
+// last with err, elapsed after the first attempt started. It returns the
+// delay to sleep before the next attempt.
+func (p RetryPolicy) Next(ctx restate.Context, err error, attempt int, elapsed time.Duration) (time.Duration, bool) {
+	return p.next(err, attempt, elapsed, func(d time.Duration) time.Duration { return p.jitter(ctx, d) })
+}
+
+// next is Next with the jitter supplied by the caller.
+func (p RetryPolicy) next(err error, attempt int, elapsed time.Duration, jitter func(time.Duration) time.Duration) (time.Duration, bool) {
+	if !p.Retryable(err) {
+		return 0, false
+	}
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	delay := jitter(p.Backoff(err, attempt))
+	if p.MaxElapsed > 0 && elapsed+delay > p.MaxElapsed {
+		return 0, false
+	}
+	return delay, true
+}
+
+// attempt classifies err, the failure of the given one-based attempt, for
+// journaling inside restate.Run. A terminal error the policy does not retry
+// is returned as is, to fail the Run itself.
+func (p RetryPolicy) attempt(err error, attempt int) (attemptOutcome, error) {
+	if err == nil {
+		return attemptOutcome{}, nil
+	}
+	retryable := p.Retryable(err)
+	if isTerminalError(err) && !retryable {
+		return attemptOutcome{}, err
+	}
+	msg := err.Error()
+	if msg == "" {
+		msg = "attempt failed"
+	}
+	return attemptOutcome{Error: msg, Retryable: retryable, Backoff: p.Backoff(err, attempt)}, nil
+}
+
+// attemptOutcome is the journaled result of one attempt run under a
+// RetryPolicy. Restate retries a Run that fails non-terminally on its own,
+// forever, so a failed attempt is returned as this value instead of as the
+// Run's error: RetryPolicy.attempt classifies the error while it is at
+// hand, and the journal keeps the verdict for replays.
+type attemptOutcome struct {
+	Error     string        `json:"error,omitempty"`
+	Retryable bool          `json:"retryable,omitempty"`
+	Backoff   time.Duration `json:"backoff,omitempty"`
+}
+
+// err turns a failed outcome back into an error the policy recognises.
+func (o attemptOutcome) err() error {
+	if o.Error == "" {
+		return nil
+	}
+	return &attemptError{outcome: o}
+}
+
+// attemptError is a failed attempt read back from the journal. RetryPolicy
+// uses the classification recorded with it rather than classifying again.
+type attemptError struct {
+	outcome attemptOutcome
+}
+
+func (e *attemptError) Error() string { return e.outcome.Error }
+
+// attemptResult is what an attempt's Run journals: the value on success,
+// the classified failure otherwise.
+type attemptResult[T any] struct {
+	Value   T              `json:"value"`
+	Outcome attemptOutcome `json:"outcome"`
+}
+
+// runAttempt runs the given one-based attempt of fn in restate.Run and
+// returns its failure as an error that retryWithPolicy can count.
+func runAttempt[T any](ctx restate.Context, p RetryPolicy, attempt int, fn func(restate.RunContext) (T, error), opts ...restate.RunOption) (T, error) {
+	res, err := restate.Run(ctx, func(rc restate.RunContext) (attemptResult[T], error) {
+		value, err := fn(rc)
+		outcome, runErr := p.attempt(err, attempt)
+		return attemptResult[T]{Value: value, Outcome: outcome}, runErr
+	}, opts...)
+	if err != nil {
+		return res.Value, err
+	}
+	return res.Value, res.Outcome.err()
+}
+
+// startAttempt is runAttempt on restate.RunAsync. The returned function
+// reports the attempt's value and error once the future has completed.
+func startAttempt[T any](ctx restate.Context, p RetryPolicy, attempt int, fn func(restate.RunContext) (T, error), opts ...restate.RunOption) (restate.Future, func() (T, error)) {
+	fut := restate.RunAsync(ctx, func(rc restate.RunContext) (attemptResult[T], error) {
+		value, err := fn(rc)
+		outcome, runErr := p.attempt(err, attempt)
+		return attemptResult[T]{Value: value, Outcome: outcome}, runErr
+	}, opts...)
+	return fut, func() (T, error) {
+		res, err := fut.Result()
+		if err != nil {
+			return res.Value, err
+		}
+		return res.Value, res.Outcome.err()
+	}
+}
+
+func (p RetryPolicy) class(err error) *RetryClass {
+	if err == nil {
+		return nil
+	}
+	for i := range p.Classes {
+		if p.Classes[i].Match != nil && p.Classes[i].Match(err) {
+			return &p.Classes[i]
+		}
+	}
+	return nil
+}
+
+// clock journals the wall clock when the policy has a MaxElapsed budget.
+// Policies without one add nothing to the journal and always read zero.
+func (p RetryPolicy) clock(ctx restate.Context, name string) time.Time {
+	if p.MaxElapsed <= 0 {
+		return time.Time{}
+	}
+	at, err := RunDo(ctx, func(rc restate.RunContext) (time.Time, error) {
+		return time.Now(), nil
+	}, restate.WithName(name+".clock"))
+	if err != nil {
+		return time.Time{}
+	}
+	return at
+}
+
+// retryWithPolicy runs body until it succeeds or the policy gives up,
+// sleeping durably between attempts. body receives the zero-based attempt.
+// exhausted distinguishes running out of attempts or time from an error
+// the policy refuses to retry.
+//
+// Errors returned from inside restate.Run never reach body's caller unless
+// they are terminal, because Restate retries the Run itself; bodies wrap
+// their side effects in runAttempt so failures are counted here.
+func retryWithPolicy(
+	ctx restate.Context,
+	p RetryPolicy,
+	name string,
+	body func(attempt int) error,
+) (attempts int, exhausted bool, err error) {
+	start := p.clock(ctx, name)
+	return p.retry(retrySchedule{
+		elapsed: func() time.Duration {
+			if start.IsZero() {
+				return 0
+			}
+			return p.clock(ctx, name).Sub(start)
+		},
+		jitter: func(d time.Duration) time.Duration { return p.jitter(ctx, d) },
+		sleep: func(attempt int, delay time.Duration, err error) error {
+			ctx.Log().Warn("retry: attempt failed",
+				"name", name,
+				"attempt", attempt,
+				"delay", delay.String(),
+				"error", err.Error())
+			if sleepErr := restate.Sleep(ctx, delay); sleepErr != nil {
+				return fmt.Errorf("retry sleep failed: %w", sleepErr)
+			}
+			return nil
+		},
+	}, body)
+}
+
+// retrySchedule is what retry needs from the Restate context: the time
+// since the first attempt, the jitter and the durable sleep.
+type retrySchedule struct {
+	elapsed func() time.Duration
+	jitter  func(time.Duration) time.Duration
+	sleep   func(attempt int, delay time.Duration, err error) error
+}
+
+// retry is the attempt loop of retryWithPolicy.
+func (p RetryPolicy) retry(sched retrySchedule, body func(attempt int) error) (attempts int, exhausted bool, err error) {
+	for attempts = 1; ; attempts++ {
+		if err = body(attempts - 1); err == nil {
+			return attempts, false, nil
+		}
+		if !p.Retryable(err) {
+			return attempts, false, err
+		}
+		delay, ok := p.next(err, attempts, sched.elapsed(), sched.jitter)
+		if !ok {
+			return attempts, true, err
+		}
+		if sleepErr := sched.sleep(attempts, delay, err); sleepErr != nil {
+			return attempts, false, sleepErr
+		}
+	}
+}
+
+// attemptsFromRetries maps the "attempts before giving up" counters of the
+// older configs, where a negative value means unlimited, onto MaxAttempts.
+func attemptsFromRetries(retries int) int {
+	switch {
+	case retries < 0:
+		return 0
+	case retries == 0:
+		return 1
+	default:
+		return retries
+	}
+}
+
 // RunConfig configures retry behavior for Run blocks
 type RunConfig struct {
 	MaxRetries    int
@@ -1395,6 +8423,27 @@ type RunConfig struct {
 	MaxDelay      time.Duration
 	BackoffFactor float64
 	Name          string
+
+	// Policy replaces MaxRetries and the delay fields when set
+	Policy *RetryPolicy
+}
+
+// policy returns Policy, or the equivalent of the legacy fields: MaxRetries
+// retries after the first attempt.
+func (c RunConfig) policy() RetryPolicy {
+	if c.Policy != nil {
+		return *c.Policy
+	}
+	attempts := c.MaxRetries + 1
+	if attempts < 1 {
+		attempts = 1
+	}
+	return RetryPolicy{
+		MaxAttempts:  attempts,
+		InitialDelay: c.InitialDelay,
+		MaxDelay:     c.MaxDelay,
+		Multiplier:   c.BackoffFactor,
+	}
 }
 
 // DefaultRunConfig returns sensible defaults for Run blocks
@@ -1414,50 +8463,31 @@ func RunWithRetry[T any](
 	cfg RunConfig,
 	operation func(restate.RunContext) (T, error),
 ) (T, error) {
-	var lastErr error
+	var result T
 	var zero T
 
-	for attempt := 0; attempt <= cfg.MaxRetries; attempt++ {
-		if attempt > 0 {
-			// Calculate backoff delay
-			delay := computeBackoff(cfg.InitialDelay, cfg.MaxDelay, attempt-1)
-			ctx.Log().Info("run: retrying after backoff",
-				"attempt", attempt,
-				"delay", delay.String(),
-				"name", cfg.Name)
-
-			// Durable sleep between retries
-			if err := restate.Sleep(ctx, delay); err != nil {
-				return zero, fmt.Errorf("retry sleep failed: %w", err)
-			}
-		}
-
-		// Execute the operation
-		result, err := restate.Run(ctx, operation, restate.WithName(cfg.Name))
-		if err == nil {
-			if attempt > 0 {
-				ctx.Log().Info("run: retry succeeded", "attempt", attempt, "name", cfg.Name)
-			}
-			return result, nil
-		}
-
-		// Check if error is terminal (don't retry)
-		if isTerminalError(err) {
-			ctx.Log().Error("run: terminal error, not retrying",
-				"error", err.Error(),
-				"name", cfg.Name)
-			return zero, err
+	policy := cfg.policy()
+	attempts, exhausted, err := retryWithPolicy(ctx, policy, cfg.Name, func(attempt int) error {
+		var runErr error
+		result, runErr = runAttempt(ctx, policy, attempt+1, operation, restate.WithName(cfg.Name))
+		return runErr
+	})
+	switch {
+	case err == nil:
+		if attempts > 1 {
+			ctx.Log().Info("run: retry succeeded", "attempt", attempts-1, "name", cfg.Name)
 		}
-
-		lastErr = err
-		ctx.Log().Warn("run: attempt failed",
-			"attempt", attempt,
+		return result, nil
+	case exhausted:
+		return zero, fmt.Errorf("run exhausted retries (%d attempts) for %s: %w",
+			attempts, cfg.Name, err)
+	default:
+		// Terminal or otherwise non-retryable: surface as-is
+		ctx.Log().Error("run: error not retried",
 			"error", err.Error(),
 			"name", cfg.Name)
+		return zero, err
 	}
-
-	return zero, fmt.Errorf("run exhausted retries (%d attempts) for %s: %w",
-		cfg.MaxRetries+1, cfg.Name, lastErr)
 }
 
 // RunAsync executes a side effect asynchronously and returns a future
@@ -1692,6 +8722,10 @@ type MetricsCollector struct {
 	InvocationDuration   map[string][]float64
 	CompensationDuration map[string][]float64
 
+	// Saga dead-letter queue
+	DLQEvents map[string]int64
+	DLQOpen   map[string]int64
+
 	mu sync.RWMutex
 }
 
@@ -1706,6 +8740,8 @@ func NewMetricsCollector() *MetricsCollector {
 		StateSize:            make(map[string]int64),
 		InvocationDuration:   make(map[string][]float64),
 		CompensationDuration: make(map[string][]float64),
+		DLQEvents:            make(map[string]int64),
+		DLQOpen:              make(map[string]int64),
 	}
 }
 
@@ -1738,6 +8774,15 @@ func (mc *MetricsCollector) RecordCompensation(stepName string, duration time.Du
 	mc.CompensationDuration[stepName] = append(mc.CompensationDuration[stepName], duration.Seconds())
 }
 
+// RecordDLQEvent counts a saga DLQ event and updates the open-record gauge
+func (mc *MetricsCollector) RecordDLQEvent(sagaName, event string, open int64) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.DLQEvents[fmt.Sprintf("%s.%s", sagaName, event)]++
+	mc.DLQOpen[sagaName] = open
+}
+
 // IncrementActiveInvocations increments active invocation gauge
 func (mc *MetricsCollector) IncrementActiveInvocations(serviceName string) {
 	mc.mu.Lock()
@@ -1773,6 +8818,8 @@ func (mc *MetricsCollector) GetMetrics() map[string]interface{} {
 		"state_size_bytes":          copyMap(mc.StateSize),
 		"invocation_duration_sec":   copyDurationMap(mc.InvocationDuration),
 		"compensation_duration_sec": copyDurationMap(mc.CompensationDuration),
+		"saga_dlq_events_total":     copyMap(mc.DLQEvents),
+		"saga_dlq_open":             copyMap(mc.DLQOpen),
 	}
 }
 
@@ -2382,6 +9429,11 @@ type WorkflowConfig struct {
 	// 3. Disabling persistence for short-lived workflows
 	EnableStatusPersistence bool
 
+	// StatusHistoryLimit bounds the transitions ProgressTracker keeps in
+	// StatusData.History; older entries are dropped first
+	// Default: 50
+	StatusHistoryLimit int
+
 	// AutoCleanupOnCompletion automatically purges workflow state after completion
 	// When true: State is deleted when workflow completes successfully
 	// When false: State retained until retention period expires
@@ -2427,6 +9479,7 @@ func DefaultWorkflowConfig() WorkflowConfig {
 	return WorkflowConfig{
 		StateRetentionDays:      30,      // 30 days
 		EnableStatusPersistence: true,    // Durable status
+		StatusHistoryLimit:      50,      // Recent transitions
 		AutoCleanupOnCompletion: false,   // Keep for audit
 		MaxStateSizeBytes:       1048576, // 1MB
 		CleanupGracePeriod:      24 * time.Hour,
@@ -2445,6 +9498,7 @@ func ProductionWorkflowConfig() WorkflowConfig {
 	return WorkflowConfig{
 		StateRetentionDays:      90,                 // Maximum retention
 		EnableStatusPersistence: true,               // Critical for production monitoring
+		StatusHistoryLimit:      200,                // Longer audit trail
 		AutoCleanupOnCompletion: false,              // Preserve for compliance/audit
 		MaxStateSizeBytes:       10 * 1024 * 1024,   // 10MB (Restate limit)
 		CleanupGracePeriod:      7 * 24 * time.Hour, // 7 days
@@ -2469,6 +9523,7 @@ func HighVolumeWorkflowConfig() WorkflowConfig {
 	return WorkflowConfig{
 		StateRetentionDays:      7,         // Minimum retention
 		EnableStatusPersistence: false,     // Ephemeral status
+		StatusHistoryLimit:      10,        // Minimal history
 		AutoCleanupOnCompletion: true,      // Aggressive cleanup
 		MaxStateSizeBytes:       524288,    // 512KB
 		CleanupGracePeriod:      time.Hour, // Fast cleanup
@@ -2514,6 +9569,10 @@ func (cfg WorkflowConfig) Validate(logger *slog.Logger) error {
 			"consideration", "higher storage costs, consider archival strategy")
 	}
 
+	if cfg.StatusHistoryLimit < 0 {
+		return fmt.Errorf("StatusHistoryLimit must be >= 0, got %d", cfg.StatusHistoryLimit)
+	}
+
 	// Check state size limit
 	if cfg.MaxStateSizeBytes < 0 {
 		return fmt.Errorf("MaxStateSizeBytes must be >= 0, got %d", cfg.MaxStateSizeBytes)
@@ -2594,6 +9653,7 @@ func (cfg WorkflowConfig) LogConfiguration(logger *slog.Logger, workflowName str
 		"workflow", workflowName,
 		"retention_days", cfg.StateRetentionDays,
 		"status_persistence", cfg.EnableStatusPersistence,
+		"status_history_limit", cfg.StatusHistoryLimit,
 		"auto_cleanup", cfg.AutoCleanupOnCompletion,
 		"max_state_mb", cfg.MaxStateSizeBytes/(1024*1024),
 		"cleanup_grace_period", cfg.CleanupGracePeriod.String())
@@ -3114,6 +10174,232 @@ func IngressWorkflow[I, O any](ic *IngressClient, serviceName, handlerName strin
 	}
 }
 
+// Status calls a workflow's status shared handler, one that returns the
+// workflow's StatusData:
+//
+//	func (OrderWorkflow) GetStatus(ctx restate.WorkflowSharedContext) (framework.StatusData, error) {
+//	    return framework.NewWorkflowStatus(ctx, "").GetStatus()
+//	}
+//
+// An empty statusHandler uses WorkflowStatusHandlerName.
+func (c IngressWorkflowClient[I, O]) Status(ctx context.Context, workflowID, statusHandler string) (StatusData, error) {
+	if statusHandler == "" {
+		statusHandler = WorkflowStatusHandlerName
+	}
+	return ingress.Workflow[restate.Void, StatusData](c.ingress.client, c.serviceName, workflowID, statusHandler).
+		Request(ctx, restate.Void{})
+}
+
+// WaitStatus calls a workflow's WaitStatus shared handler (see
+// WorkflowStatus.WaitStatus), which returns once the status is newer than
+// req.After or req.Timeout elapses. An empty waitHandler uses
+// WorkflowStatusWaitHandlerName.
+func (c IngressWorkflowClient[I, O]) WaitStatus(ctx context.Context, workflowID, waitHandler string, req StatusWaitRequest) (StatusData, error) {
+	if waitHandler == "" {
+		waitHandler = WorkflowStatusWaitHandlerName
+	}
+	return ingress.Workflow[StatusWaitRequest, StatusData](c.ingress.client, c.serviceName, workflowID, waitHandler).
+		Request(ctx, req)
+}
+
+const (
+	// WorkflowStatusHandlerName is the status shared handler name assumed
+	// by IngressWorkflowClient.Status.
+	WorkflowStatusHandlerName = "GetStatus"
+
+	// WorkflowStatusWaitHandlerName is the blocking status shared handler
+	// name assumed by IngressWorkflowClient.WaitStatus and
+	// StatusStreamHandler.
+	WorkflowStatusWaitHandlerName = "WaitStatus"
+)
+
+// StatusStreamConfig configures StatusStreamHandler.
+type StatusStreamConfig struct {
+	// WaitHandler is the workflow's blocking status shared handler
+	// Default: WorkflowStatusWaitHandlerName
+	WaitHandler string
+
+	// Heartbeat bounds each wait; when it elapses without a change an SSE
+	// comment is sent, keeping proxies from closing the connection
+	// Default: 15s
+	Heartbeat time.Duration
+
+	// MaxErrors closes the stream after this many consecutive failed waits,
+	// e.g. for an unknown workflow ID
+	// Default: 5
+	MaxErrors int
+
+	// ErrorDelay is the pause after a failed wait
+	// Default: 1s
+	ErrorDelay time.Duration
+}
+
+// StatusStreamHandler streams a workflow's StatusData to browsers as
+// Server-Sent Events. The workflow ID comes from the "id" path value or
+// query parameter. Each change is sent as a "status" event whose data is
+// the StatusData JSON and whose ID is its Version; the stream ends after a
+// status with IsComplete or Error set, or an "error" event once waiting
+// keeps failing.
+//
+//	orders := framework.IngressWorkflow[Order, Receipt](ic, "OrderWorkflow", "Run")
+//	mux.Handle("GET /orders/{id}/status", framework.StatusStreamHandler(orders, framework.StatusStreamConfig{}))
+//
+// The handler long-polls the workflow's WaitStatus shared handler through
+// the ingress, so each status reaches the browser as soon as ProgressTracker
+// writes it. The workflow must expose WaitStatus and run with
+// WorkflowConfig.EnableStatusPersistence on.
+//
+// Reconnecting clients resume via Last-Event-ID without receiving the same
+// status again, except the final one, which is repeated so the client knows
+// to close its EventSource instead of reconnecting.
+func StatusStreamHandler[I, O any](client *IngressWorkflowClient[I, O], cfg StatusStreamConfig) http.Handler {
+	if cfg.WaitHandler == "" {
+		cfg.WaitHandler = WorkflowStatusWaitHandlerName
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = 15 * time.Second
+	}
+	if cfg.MaxErrors <= 0 {
+		cfg.MaxErrors = 5
+	}
+	if cfg.ErrorDelay <= 0 {
+		cfg.ErrorDelay = time.Second
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		workflowID := r.PathValue("id")
+		if workflowID == "" {
+			workflowID = r.URL.Query().Get("id")
+		}
+		if workflowID == "" {
+			http.Error(w, "workflow id is required", http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+		h.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		log := client.ingress.log.With("service", client.serviceName, "workflow_id", workflowID)
+		log.Info("ingress: status stream opened")
+		defer log.Info("ingress: status stream closed")
+
+		ctx := r.Context()
+		after, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+		failures := 0
+
+		for {
+			status, err := client.WaitStatus(ctx, workflowID, cfg.WaitHandler,
+				StatusWaitRequest{After: after, Timeout: cfg.Heartbeat})
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil:
+				failures++
+				log.Warn("ingress: status wait failed", "attempt", failures, "error", err.Error())
+				if failures >= cfg.MaxErrors {
+					writeSSE(w, "error", "", []byte(strconv.Quote(err.Error())))
+					flusher.Flush()
+					return
+				}
+				timer := time.NewTimer(cfg.ErrorDelay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+				continue
+			}
+
+			failures = 0
+			final := status.IsComplete || status.Error != ""
+			if status.Version <= after && !final {
+				// The wait timed out unchanged
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+				continue
+			}
+
+			// A final status is sent even if the client saw it, so it closes
+			data, err := json.Marshal(status)
+			if err != nil {
+				writeSSE(w, "error", "", []byte(strconv.Quote(err.Error())))
+				flusher.Flush()
+				return
+			}
+			writeSSE(w, "status", strconv.Itoa(status.Version), data)
+			flusher.Flush()
+			if final {
+				return
+			}
+			after = status.Version
+		}
+	})
+}
+
+// writeSSE writes one Server-Sent Event. data must not contain newlines.
+func writeSSE(w io.Writer, event, id string, data []byte) {
+	fmt.Fprintf(w, "event: %s\n", event)
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+// ValidateSagaRegistryFromDLQ runs ValidateSagaRegistry at startup against
+// the step names in a saga's open SagaDLQ records, the persisted entries
+// reachable from outside a workflow:
+//
+//	ic := framework.NewIngressClient("http://localhost:8080", "")
+//	if err := framework.ValidateSagaRegistryFromDLQ(ctx, ic, "checkout"); err != nil {
+//	    log.Fatal(err)
+//	}
+func ValidateSagaRegistryFromDLQ(ctx context.Context, ic *IngressClient, sagaName string) error {
+	records, err := IngressObject[restate.Void, []SagaDLQRecord](ic, SagaDLQServiceName, "List").
+		Call(ctx, sagaName, restate.Void{})
+	if err != nil {
+		return fmt.Errorf("saga registry: list DLQ records for %s: %w", sagaName, err)
+	}
+
+	var names []string
+	for _, r := range records {
+		if r.Status == SagaDLQOpen {
+			names = append(names, SagaStepNames(r.Entries)...)
+		}
+	}
+	return ValidateSagaRegistry(sagaName, names, ic.log)
+}
+
+// CheckVersionReachability fetches the WorkflowVersions report for a change
+// from outside Restate, e.g. in a deploy pipeline, and raises the
+// "version_branch_unreachable" guardrail under the global policy when some
+// branches can be deleted.
+func CheckVersionReachability(ctx context.Context, ic *IngressClient, changeID string) (VersionReport, error) {
+	report, err := IngressObject[restate.Void, VersionReport](ic, WorkflowVersionsServiceName, "Report").
+		Call(ctx, changeID, restate.Void{})
+	if err != nil {
+		return VersionReport{}, fmt.Errorf("version: report for %s: %w", changeID, err)
+	}
+	if len(report.Unreachable) > 0 {
+		err = HandleGuardrailViolation(GuardrailViolation{
+			Check:    "version_branch_unreachable",
+			Message:  fmt.Sprintf("change %s: no running instance uses versions %v", changeID, report.Unreachable),
+			Severity: "warning",
+		}, ic.log, "")
+	}
+	return report, err
+}
+
 // -----------------------------------------------------------------------------
 // Section 8: Concurrency Utilities
 // -----------------------------------------------------------------------------
@@ -3956,6 +11242,39 @@ func canonicalizeValue(v any) any {
 	}
 }
 
+// futureIndex returns the position of fut in futures, or -1 if absent.
+func futureIndex(futures []restate.Future, fut restate.Future) int {
+	for i, f := range futures {
+		if f == fut {
+			return i
+		}
+	}
+	return -1
+}
+
+// dedupeStrings drops repeated values, keeping first-seen order.
+func dedupeStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// timerIndex finds the position of a timer future in a slice.
+func timerIndex(timers []restate.AfterFuture, fut restate.Future) int {
+	for i, t := range timers {
+		if t != nil && restate.Future(t) == fut {
+			return i
+		}
+	}
+	return -1
+}
+
 // removeIndex removes an element from a slice.
 func removeIndex[T any](s []T, i int) []T {
 	if i < 0 || i >= len(s) {
@@ -0,0 +1,829 @@
+package framework
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	restate "github.com/restatedev/sdk-go"
+)
+
+func cronBits(values ...int) uint64 {
+	var bits uint64
+	for _, v := range values {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+func cronRange(lo, hi, step int) uint64 {
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		min, max int
+		names    map[string]int
+		want     uint64
+		wantErr  bool
+	}{
+		{name: "star", field: "*", min: 0, max: 59, want: cronRange(0, 59, 1)},
+		{name: "star step", field: "*/15", min: 0, max: 59, want: cronBits(0, 15, 30, 45)},
+		{name: "single", field: "7", min: 0, max: 23, want: cronBits(7)},
+		{name: "range", field: "1-5", min: 0, max: 7, want: cronRange(1, 5, 1)},
+		{name: "range step", field: "10-30/10", min: 0, max: 59, want: cronBits(10, 20, 30)},
+		{name: "start step", field: "5/20", min: 0, max: 59, want: cronBits(5, 25, 45)},
+		{name: "list", field: "1,15,31", min: 1, max: 31, want: cronBits(1, 15, 31)},
+		{name: "names", field: "mon,WED", min: 0, max: 7, names: cronDayNames, want: cronBits(1, 3)},
+		{name: "name range", field: "jan-mar", min: 1, max: 12, names: cronMonthNames, want: cronBits(1, 2, 3)},
+		{name: "above max", field: "60", min: 0, max: 59, wantErr: true},
+		{name: "below min", field: "0", min: 1, max: 31, wantErr: true},
+		{name: "reversed range", field: "5-1", min: 0, max: 59, wantErr: true},
+		{name: "zero step", field: "*/0", min: 0, max: 59, wantErr: true},
+		{name: "bad step", field: "*/x", min: 0, max: 59, wantErr: true},
+		{name: "unknown name", field: "funday", min: 0, max: 7, names: cronDayNames, wantErr: true},
+		{name: "empty", field: "", min: 0, max: 59, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCronField(tt.field, tt.min, tt.max, tt.names)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCronField(%q) = %b, want error", tt.field, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCronField(%q) failed: %v", tt.field, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseCronField(%q) = %b, want %b", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		check   func(*cronRecurrence) bool
+		wantErr string
+	}{
+		{
+			name: "descriptor",
+			expr: "@daily",
+			check: func(c *cronRecurrence) bool {
+				return c.minute == cronBits(0) && c.hour == cronBits(0) && c.domStar && c.dowStar
+			},
+		},
+		{
+			name:  "descriptor case and spaces",
+			expr:  "  @Hourly ",
+			check: func(c *cronRecurrence) bool { return c.minute == cronBits(0) && c.hour == cronRange(0, 23, 1) },
+		},
+		{
+			name:  "weekdays",
+			expr:  "30 9 * * mon-fri",
+			check: func(c *cronRecurrence) bool { return c.dow == cronRange(1, 5, 1) && c.domStar && !c.dowStar },
+		},
+		{
+			name:  "seven is sunday",
+			expr:  "0 0 * * 7",
+			check: func(c *cronRecurrence) bool { return c.dow&1 != 0 },
+		},
+		{name: "too few fields", expr: "0 0 * *", wantErr: "expected 5 fields"},
+		{name: "too many fields", expr: "0 0 * * * *", wantErr: "expected 5 fields"},
+		{name: "bad minute", expr: "61 * * * *", wantErr: "minute"},
+		{name: "bad hour", expr: "0 24 * * *", wantErr: "hour"},
+		{name: "bad day of month", expr: "0 0 0 * *", wantErr: "day of month"},
+		{name: "bad month", expr: "0 0 * 13 *", wantErr: "month"},
+		{name: "bad day of week", expr: "0 0 * * 8", wantErr: "day of week"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCron(tt.expr, time.UTC)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseCron(%q) error = %v, want %q", tt.expr, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCron(%q) failed: %v", tt.expr, err)
+			}
+			if !tt.check(c) {
+				t.Errorf("parseCron(%q) = %+v", tt.expr, *c)
+			}
+		})
+	}
+}
+
+func TestCronRecurrenceNext(t *testing.T) {
+	at := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{name: "next quarter hour", expr: "*/15 * * * *", from: at(2024, 1, 1, 10, 7), want: at(2024, 1, 1, 10, 15)},
+		{name: "strictly after", expr: "*/15 * * * *", from: at(2024, 1, 1, 10, 15), want: at(2024, 1, 1, 10, 30)},
+		{name: "seconds truncated", expr: "* * * * *", from: at(2024, 1, 1, 10, 7).Add(59 * time.Second), want: at(2024, 1, 1, 10, 8)},
+		{name: "next day", expr: "0 9 * * *", from: at(2024, 1, 1, 9, 0), want: at(2024, 1, 2, 9, 0)},
+		{name: "skips weekend", expr: "0 9 * * mon-fri", from: at(2024, 1, 5, 10, 0), want: at(2024, 1, 8, 9, 0)},
+		{name: "month rollover", expr: "@monthly", from: at(2024, 1, 31, 12, 0), want: at(2024, 2, 1, 0, 0)},
+		{name: "year rollover", expr: "@yearly", from: at(2024, 6, 1, 0, 0), want: at(2025, 1, 1, 0, 0)},
+		{name: "leap day", expr: "0 0 29 2 *", from: at(2024, 3, 1, 0, 0), want: at(2028, 2, 29, 0, 0)},
+		{name: "never", expr: "0 0 30 2 *", from: at(2024, 1, 1, 0, 0), want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCron(tt.expr, time.UTC)
+			if err != nil {
+				t.Fatalf("parseCron(%q) failed: %v", tt.expr, err)
+			}
+			if got := c.next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("next(%s) for %q = %s, want %s", tt.from, tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronDayMatches(t *testing.T) {
+	friday13 := time.Date(2024, 9, 13, 0, 0, 0, 0, time.UTC)
+	friday6 := time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC)
+	sunday13 := time.Date(2024, 10, 13, 0, 0, 0, 0, time.UTC)
+	tuesday10 := time.Date(2024, 9, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		day  time.Time
+		want bool
+	}{
+		// Both fields restricted: either one matching is enough
+		{name: "both restricted, both match", expr: "0 0 13 * fri", day: friday13, want: true},
+		{name: "both restricted, weekday matches", expr: "0 0 13 * fri", day: friday6, want: true},
+		{name: "both restricted, date matches", expr: "0 0 13 * fri", day: sunday13, want: true},
+		{name: "both restricted, neither matches", expr: "0 0 13 * fri", day: tuesday10, want: false},
+
+		// One field restricted: only that field counts
+		{name: "date only, match", expr: "0 0 13 * *", day: sunday13, want: true},
+		{name: "date only, no match", expr: "0 0 13 * *", day: friday6, want: false},
+		{name: "weekday only, match", expr: "0 0 * * fri", day: friday6, want: true},
+		{name: "weekday only, no match", expr: "0 0 * * fri", day: sunday13, want: false},
+		{name: "unrestricted", expr: "0 0 * * *", day: tuesday10, want: true},
+
+		// A stepped "*" still counts as unrestricted, as in Vixie cron
+		{name: "stepped star date, weekday must match", expr: "0 0 */2 * fri", day: sunday13, want: false},
+		{name: "stepped star date, both match", expr: "0 0 */2 * fri", day: friday13, want: true},
+		{name: "stepped star weekday, date must match", expr: "0 0 13 * */2", day: friday6, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCron(tt.expr, time.UTC)
+			if err != nil {
+				t.Fatalf("parseCron(%q) failed: %v", tt.expr, err)
+			}
+			if got := c.dayMatches(tt.day); got != tt.want {
+				t.Errorf("dayMatches(%s) for %q = %v, want %v", tt.day.Format("Mon 2006-01-02"), tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleMissedRun(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	type result struct{ missed, catchUp bool }
+	tests := []struct {
+		name   string
+		policy MissedRunPolicy
+		max    int
+		nexts  []time.Time
+		want   []result
+	}{
+		{
+			name:   "not missed",
+			policy: MissedRunCatchUp, max: 3,
+			nexts: []time.Time{future, now, {}},
+			want:  []result{{false, false}, {false, false}, {false, false}},
+		},
+		{
+			name:   "skip policy",
+			policy: MissedRunSkip, max: 3,
+			nexts: []time.Time{past, past},
+			want:  []result{{true, false}, {true, false}},
+		},
+		{
+			name:   "catch up to the limit then skip",
+			policy: MissedRunCatchUp, max: 2,
+			nexts: []time.Time{past, past, past, past},
+			want:  []result{{true, true}, {true, true}, {true, false}, {true, true}},
+		},
+		{
+			name:   "on-time tick resets the count",
+			policy: MissedRunCatchUp, max: 2,
+			nexts: []time.Time{past, future, past, past, past},
+			want:  []result{{true, true}, {false, false}, {true, true}, {true, true}, {true, false}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &scheduleState{Status: ScheduleStatus{Spec: ScheduleSpec{MissedRuns: tt.policy, MaxCatchUp: tt.max}}}
+			for i, next := range tt.nexts {
+				missed, catchUp := st.missedRun(next, now)
+				if got := (result{missed, catchUp}); got != tt.want[i] {
+					t.Errorf("tick %d: missedRun = %+v, want %+v", i, got, tt.want[i])
+				}
+				if st.CatchUp > tt.max {
+					t.Errorf("tick %d: CatchUp = %d exceeds MaxCatchUp %d", i, st.CatchUp, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestIntervalRecurrenceNext(t *testing.T) {
+	anchor := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		anchor time.Time
+		from   time.Time
+		want   time.Time
+	}{
+		{name: "first run", anchor: anchor, from: anchor, want: anchor.Add(time.Hour)},
+		{name: "on an occurrence", anchor: anchor, from: anchor.Add(3 * time.Hour), want: anchor.Add(4 * time.Hour)},
+		{name: "resumed between occurrences keeps the phase", anchor: anchor, from: anchor.Add(150 * time.Minute), want: anchor.Add(3 * time.Hour)},
+		{name: "before the anchor", anchor: anchor, from: anchor.Add(-time.Minute), want: anchor.Add(time.Hour)},
+		{name: "no anchor", from: anchor.Add(10 * time.Minute), want: anchor.Add(70 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := intervalRecurrence{every: time.Hour, anchor: tt.anchor}
+			if got := r.next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkflowSpecRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry *WorkflowSpecRetry
+		want  RetryPolicy
+	}{
+		{name: "no retry block", retry: nil, want: RetryPolicy{MaxAttempts: 1}},
+		{name: "attempts default to one", retry: &WorkflowSpecRetry{InitialDelay: "1s"}, want: RetryPolicy{MaxAttempts: 1, InitialDelay: time.Second}},
+		{
+			name:  "time budget only",
+			retry: &WorkflowSpecRetry{MaxElapsed: "5m"},
+			want:  RetryPolicy{MaxElapsed: 5 * time.Minute},
+		},
+		{
+			name:  "all fields",
+			retry: &WorkflowSpecRetry{MaxAttempts: 4, InitialDelay: "2s", MaxDelay: "1m", MaxElapsed: "10m", Jitter: 0.3},
+			want:  RetryPolicy{MaxAttempts: 4, InitialDelay: 2 * time.Second, MaxDelay: time.Minute, MaxElapsed: 10 * time.Minute, Jitter: 0.3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.retry.policy()
+			if got.MaxAttempts != tt.want.MaxAttempts || got.InitialDelay != tt.want.InitialDelay ||
+				got.MaxDelay != tt.want.MaxDelay || got.MaxElapsed != tt.want.MaxElapsed || got.Jitter != tt.want.Jitter {
+				t.Errorf("policy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeSchedule records the sleeps of RetryPolicy.retry against a clock that
+// advances by each delay.
+type fakeSchedule struct {
+	now    time.Duration
+	delays []time.Duration
+}
+
+func (f *fakeSchedule) schedule() retrySchedule {
+	return retrySchedule{
+		elapsed: func() time.Duration { return f.now },
+		jitter:  func(d time.Duration) time.Duration { return d },
+		sleep: func(attempt int, delay time.Duration, err error) error {
+			f.delays = append(f.delays, delay)
+			f.now += delay
+			return nil
+		},
+	}
+}
+
+func TestRetryPolicyRetry(t *testing.T) {
+	errFlaky := errors.New("connection reset")
+	errDeclined := errors.New("card declined")
+	errLimited := errors.New("rate limited")
+
+	tests := []struct {
+		name          string
+		policy        RetryPolicy
+		failures      []error
+		wantAttempts  int
+		wantExhausted bool
+		wantErr       error
+		wantDelays    []time.Duration
+	}{
+		{
+			name:         "succeeds first time",
+			policy:       RetryPolicy{MaxAttempts: 3},
+			wantAttempts: 1,
+		},
+		{
+			name:         "succeeds after failures",
+			policy:       RetryPolicy{MaxAttempts: 3, InitialDelay: time.Second},
+			failures:     []error{errFlaky, errFlaky},
+			wantAttempts: 3,
+			wantDelays:   []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:          "non-terminal failures count against max attempts",
+			policy:        RetryPolicy{MaxAttempts: 3, InitialDelay: time.Second},
+			failures:      []error{errFlaky, errFlaky, errFlaky, errFlaky},
+			wantAttempts:  3,
+			wantExhausted: true,
+			wantErr:       errFlaky,
+			wantDelays:    []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:         "abort on stops at once",
+			policy:       RetryPolicy{MaxAttempts: 5, AbortOn: func(err error) bool { return errors.Is(err, errDeclined) }},
+			failures:     []error{errFlaky, errDeclined},
+			wantAttempts: 2,
+			wantErr:      errDeclined,
+			wantDelays:   []time.Duration{time.Second},
+		},
+		{
+			name:          "max elapsed bounds unlimited attempts",
+			policy:        RetryPolicy{InitialDelay: time.Second, MaxElapsed: 5 * time.Second},
+			failures:      []error{errFlaky, errFlaky, errFlaky, errFlaky},
+			wantAttempts:  3,
+			wantExhausted: true,
+			wantErr:       errFlaky,
+			wantDelays:    []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name: "classes get their own delays",
+			policy: RetryPolicy{MaxAttempts: 3, InitialDelay: time.Second, Classes: []RetryClass{
+				{Name: "rate_limited", Match: func(err error) bool { return errors.Is(err, errLimited) }, InitialDelay: 10 * time.Second},
+			}},
+			failures:     []error{errLimited, errFlaky},
+			wantAttempts: 3,
+			wantDelays:   []time.Duration{10 * time.Second, 2 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sched fakeSchedule
+			attempts, exhausted, err := tt.policy.retry(sched.schedule(), func(attempt int) error {
+				if attempt < len(tt.failures) {
+					return tt.failures[attempt]
+				}
+				return nil
+			})
+			if attempts != tt.wantAttempts || exhausted != tt.wantExhausted || !errors.Is(err, tt.wantErr) {
+				t.Errorf("retry() = (%d, %v, %v), want (%d, %v, %v)",
+					attempts, exhausted, err, tt.wantAttempts, tt.wantExhausted, tt.wantErr)
+			}
+			if len(sched.delays) != len(tt.wantDelays) {
+				t.Fatalf("delays = %v, want %v", sched.delays, tt.wantDelays)
+			}
+			for i := range sched.delays {
+				if sched.delays[i] != tt.wantDelays[i] {
+					t.Errorf("delays = %v, want %v", sched.delays, tt.wantDelays)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyAttemptOutcome(t *testing.T) {
+	errLimited := errors.New("rate limited")
+	policy := RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Second,
+		Classes: []RetryClass{
+			{Name: "rate_limited", Match: func(err error) bool { return errors.Is(err, errLimited) }, InitialDelay: 10 * time.Second},
+		},
+	}
+
+	outcome, err := policy.attempt(errLimited, 2)
+	if err != nil {
+		t.Fatalf("attempt() failed the run: %v", err)
+	}
+	if outcome.Error != "rate limited" || !outcome.Retryable || outcome.Backoff != 20*time.Second {
+		t.Errorf("attempt() = %+v", outcome)
+	}
+
+	// Read back from the journal, the outcome keeps its classification
+	// although the class no longer matches the error.
+	failed := outcome.err()
+	if !policy.Retryable(failed) || policy.Backoff(failed, 2) != 20*time.Second {
+		t.Errorf("replayed outcome: retryable %v, backoff %s", policy.Retryable(failed), policy.Backoff(failed, 2))
+	}
+
+	if outcome, err := policy.attempt(nil, 1); err != nil || outcome.err() != nil {
+		t.Errorf("attempt(nil) = (%+v, %v)", outcome, err)
+	}
+	if outcome, _ := policy.attempt(errors.New(""), 1); outcome.err() == nil {
+		t.Error("attempt() lost a failure with an empty message")
+	}
+}
+
+func TestCompensationGraph(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []SagaEntry
+		wantDeps  [][]int
+		wantOrder []int
+	}{
+		{
+			name:      "ungrouped steps roll back in LIFO order",
+			entries:   []SagaEntry{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+			wantDeps:  [][]int{nil, {0}, {1}},
+			wantOrder: []int{2, 1, 0},
+		},
+		{
+			name:      "group siblings share their predecessors",
+			entries:   []SagaEntry{{Name: "a"}, {Name: "b", Group: "g"}, {Name: "c", Group: "g"}, {Name: "d"}},
+			wantDeps:  [][]int{nil, {0}, {0}, {1, 2}},
+			wantOrder: []int{3, 2, 1, 0},
+		},
+		{
+			name: "depends on overrides the order of addition",
+			entries: []SagaEntry{
+				{Name: "inventory"}, {Name: "payment", Group: "order"},
+				{Name: "shipment", DependsOn: []string{"inventory"}},
+			},
+			wantDeps:  [][]int{nil, {0}, {0}},
+			wantOrder: []int{2, 1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps := compensationGraph(tt.entries)
+			if len(deps) != len(tt.wantDeps) {
+				t.Fatalf("compensationGraph() = %v, want %v", deps, tt.wantDeps)
+			}
+			for i := range deps {
+				if !equalInts(deps[i], tt.wantDeps[i]) {
+					t.Errorf("compensationGraph() = %v, want %v", deps, tt.wantDeps)
+					break
+				}
+			}
+			if order := compensationOrder(tt.entries, -1); !equalInts(order, tt.wantOrder) {
+				t.Errorf("compensationOrder() = %v, want %v", order, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestCompensationOrderResumesAtCursor(t *testing.T) {
+	entries := []SagaEntry{{Name: "a", Group: "g"}, {Name: "b", Group: "g"}, {Name: "c", Group: "g"}}
+
+	// The failed step is retried first; its siblings follow in LIFO order
+	if order := compensationOrder(entries, 0); !equalInts(order, []int{0, 2, 1}) {
+		t.Errorf("compensationOrder(0) = %v, want [0 2 1]", order)
+	}
+
+	// A cursor still blocked by dependents is not jumped ahead
+	chain := []SagaEntry{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	if order := compensationOrder(chain, 0); !equalInts(order, []int{2, 1, 0}) {
+		t.Errorf("compensationOrder(0) = %v, want [2 1 0]", order)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSagaConfigRetryMapping(t *testing.T) {
+	tests := []struct {
+		retries int
+		want    int
+	}{
+		{retries: -1, want: 0},
+		{retries: 0, want: 1},
+		{retries: 10, want: 10},
+	}
+
+	for _, tt := range tests {
+		cfg := SagaConfig{MaxRetries: tt.retries, ForwardMaxRetries: tt.retries}
+		if got := cfg.compensationPolicy().MaxAttempts; got != tt.want {
+			t.Errorf("MaxRetries %d: compensation MaxAttempts = %d, want %d", tt.retries, got, tt.want)
+		}
+		if got := cfg.forwardPolicy().MaxAttempts; got != tt.want {
+			t.Errorf("ForwardMaxRetries %d: forward MaxAttempts = %d, want %d", tt.retries, got, tt.want)
+		}
+	}
+
+	// A custom policy keeps its delays but forward attempts stay bounded
+	cfg := SagaConfig{ForwardMaxRetries: 3, RetryPolicy: &RetryPolicy{MaxAttempts: 8, InitialDelay: time.Minute}}
+	if p := cfg.forwardPolicy(); p.MaxAttempts != 3 || p.InitialDelay != time.Minute {
+		t.Errorf("forwardPolicy() = %+v", p)
+	}
+}
+
+func TestWorkflowSpecValidate(t *testing.T) {
+	activity := func(name string) WorkflowSpecStep {
+		return WorkflowSpecStep{Name: name, Activity: "acts." + name}
+	}
+
+	tests := []struct {
+		name    string
+		spec    WorkflowSpec
+		wantErr string
+	}{
+		{
+			name: "valid",
+			spec: WorkflowSpec{Name: "order", Steps: []WorkflowSpecStep{
+				activity("reserve"),
+				{Name: "big", Type: WorkflowSpecBranch, If: "amount > 1000", Then: []WorkflowSpecStep{
+					{Name: "manager", Type: WorkflowSpecApproval, Timeout: "48h", OnTimeout: "approve"},
+				}, Else: []WorkflowSpecStep{activity("auto")}},
+				{Name: "settle", Type: WorkflowSpecSleep, Duration: "1h"},
+				{Name: "charge", Activity: "acts.charge", Retry: &WorkflowSpecRetry{
+					MaxAttempts: 3, InitialDelay: "1s", MaxDelay: "10s", MaxElapsed: "1m", Jitter: 0.2,
+				}},
+			}},
+		},
+		{name: "missing name", spec: WorkflowSpec{Steps: []WorkflowSpecStep{activity("a")}}, wantErr: "name is required"},
+		{name: "no steps", spec: WorkflowSpec{Name: "empty"}, wantErr: "no steps"},
+		{name: "unnamed step", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Activity: "acts.a"}}}, wantErr: "step without a name"},
+		{
+			name: "duplicate name in branch",
+			spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{
+				activity("a"),
+				{Name: "b", Type: WorkflowSpecBranch, If: "flag", Then: []WorkflowSpecStep{activity("a")}},
+			}},
+			wantErr: `duplicate step name "a"`,
+		},
+		{name: "no type or activity", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a"}}}, wantErr: "unknown type"},
+		{name: "unknown type", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Type: "fork"}}}, wantErr: "unknown type"},
+		{name: "activity type without activity", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Type: WorkflowSpecActivity}}}, wantErr: "activity is required"},
+		{name: "bad timeout", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Type: WorkflowSpecApproval, Timeout: "5x"}}}, wantErr: "timeout"},
+		{name: "negative timeout", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Type: WorkflowSpecApproval, Timeout: "-1s"}}}, wantErr: "negative duration"},
+		{name: "activity timeout", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Activity: "x", Timeout: "30s"}}}, wantErr: "do not support timeout"},
+		{name: "sleep without duration", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Type: WorkflowSpecSleep}}}, wantErr: "duration is required"},
+		{name: "bad condition", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Type: WorkflowSpecBranch, If: "a ~ b"}}}, wantErr: "unknown operator"},
+		{name: "empty condition", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Type: WorkflowSpecBranch}}}, wantErr: "condition"},
+		{name: "bad on_timeout", spec: WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Type: WorkflowSpecApproval, OnTimeout: "maybe"}}}, wantErr: "on_timeout"},
+		{
+			name:    "bad retry delay",
+			spec:    WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Activity: "x", Retry: &WorkflowSpecRetry{MaxAttempts: 2, MaxElapsed: "soon"}}}},
+			wantErr: "retry.max_elapsed",
+		},
+		{
+			name:    "bad retry jitter",
+			spec:    WorkflowSpec{Name: "s", Steps: []WorkflowSpecStep{{Name: "a", Activity: "x", Retry: &WorkflowSpecRetry{MaxAttempts: 2, Jitter: 1.5}}}},
+			wantErr: "retry.jitter",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseWorkflowSpecJSON(t *testing.T) {
+	spec, err := ParseWorkflowSpec([]byte(`{"name": "order", "steps": [{"name": "reserve", "activity": "inventory.reserve"}]}`))
+	if err != nil {
+		t.Fatalf("ParseWorkflowSpec failed: %v", err)
+	}
+	if spec.Name != "order" || len(spec.Steps) != 1 || spec.Steps[0].kind() != WorkflowSpecActivity {
+		t.Errorf("ParseWorkflowSpec = %+v", *spec)
+	}
+
+	if _, err := ParseWorkflowSpec([]byte(`{"name": "order", "steps": []}`)); err == nil {
+		t.Error("ParseWorkflowSpec accepted a spec without steps")
+	}
+}
+
+func TestNewVersionReport(t *testing.T) {
+	report := newVersionReport("split-shipping", [2]int{1, 4}, map[string]int{
+		"key:order-1":        1,
+		"key:order-2":        4,
+		"invocation:inv-abc": 4,
+	})
+
+	if report.ChangeID != "split-shipping" || report.MinVersion != 1 || report.MaxVersion != 4 {
+		t.Errorf("newVersionReport() = %+v", report)
+	}
+	if report.Running[1] != 1 || report.Running[4] != 2 || len(report.Running) != 2 {
+		t.Errorf("Running = %v, want map[1:1 4:2]", report.Running)
+	}
+	// Versions 2 and 3 have no instance left; max is always reachable
+	if !equalInts(report.Unreachable, []int{2, 3}) {
+		t.Errorf("Unreachable = %v, want [2 3]", report.Unreachable)
+	}
+
+	if empty := newVersionReport("c", [2]int{2, 2}, nil); len(empty.Unreachable) != 0 {
+		t.Errorf("single version: Unreachable = %v, want none", empty.Unreachable)
+	}
+}
+
+func TestHumanTaskCount(t *testing.T) {
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	approve := func(who string) HumanTaskVote { return HumanTaskVote{Approver: who, Approved: true, At: at} }
+	reject := func(who string) HumanTaskVote { return HumanTaskVote{Approver: who, At: at} }
+
+	type cast struct {
+		escalation bool
+		vote       HumanTaskVote
+	}
+	tests := []struct {
+		name         string
+		quorum       int
+		escalateTo   string
+		votes        []cast
+		wantDecided  []bool // after each vote
+		wantApproved bool
+	}{
+		{
+			name:         "quorum of two",
+			quorum:       2,
+			votes:        []cast{{vote: approve("ann")}, {vote: approve("bob")}},
+			wantDecided:  []bool{false, true},
+			wantApproved: true,
+		},
+		{
+			name:        "rejected once the quorum is unreachable",
+			quorum:      2,
+			votes:       []cast{{vote: approve("ann")}, {vote: reject("bob")}, {vote: reject("cid")}},
+			wantDecided: []bool{false, false, true},
+		},
+		{
+			name:         "pending manager keeps an unreachable quorum open",
+			quorum:       3,
+			escalateTo:   "mgr",
+			votes:        []cast{{vote: reject("ann")}, {escalation: true, vote: approve("mgr")}},
+			wantDecided:  []bool{false, true},
+			wantApproved: true,
+		},
+		{
+			name:        "manager decides alone",
+			quorum:      1,
+			escalateTo:  "mgr",
+			votes:       []cast{{escalation: true, vote: reject("mgr")}},
+			wantDecided: []bool{true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &humanTaskRun{
+				log:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+				task: HumanTask{ID: "t", Approvers: []string{"ann", "bob", "cid"}, Quorum: tt.quorum},
+			}
+			for _, a := range r.task.Approvers {
+				r.pending = append(r.pending, humanTaskSlot{assignee: a})
+			}
+			if tt.escalateTo != "" {
+				r.pending = append(r.pending, humanTaskSlot{assignee: tt.escalateTo, escalation: true})
+			}
+
+			for i, c := range tt.votes {
+				for idx, slot := range r.pending {
+					if slot.assignee == c.vote.Approver && slot.escalation == c.escalation {
+						r.pending = removeIndex(r.pending, idx)
+						break
+					}
+				}
+				if got := r.count(humanTaskSlot{assignee: c.vote.Approver, escalation: c.escalation}, c.vote); got != tt.wantDecided[i] {
+					t.Fatalf("vote %d: count() = %v, want %v", i, got, tt.wantDecided[i])
+				}
+			}
+			if r.out.Approved != tt.wantApproved {
+				t.Errorf("Approved = %v, want %v", r.out.Approved, tt.wantApproved)
+			}
+		})
+	}
+}
+
+func TestHumanTaskCountRecordsDelegations(t *testing.T) {
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	r := &humanTaskRun{
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		task:    HumanTask{ID: "t", Approvers: []string{"ann", "bob"}, Quorum: 2},
+		pending: []humanTaskSlot{{assignee: "bob"}},
+	}
+	vote := HumanTaskVote{
+		Approver: "cid", OnBehalfOf: "ann", Approved: true, At: at.Add(time.Hour),
+		Delegations: []HumanTaskEvent{
+			{At: at, Kind: "delegated", Actor: "ann", OnBehalfOf: "ann", To: "cid", Comment: "on leave"},
+		},
+	}
+	if r.count(humanTaskSlot{assignee: "ann"}, vote) {
+		t.Fatal("count() decided the task after one of two approvals")
+	}
+	if len(r.out.Trail) != 2 || r.out.Trail[0].Kind != "delegated" || r.out.Trail[0].To != "cid" ||
+		r.out.Trail[1].Kind != "approved" || r.out.Trail[1].OnBehalfOf != "ann" {
+		t.Errorf("Trail = %+v", r.out.Trail)
+	}
+}
+
+func TestHumanTaskSlotKey(t *testing.T) {
+	keys := map[string]bool{
+		humanTaskSlotKey("wf/t", false, "ann"): true,
+		humanTaskSlotKey("wf/t", false, "bob"): true,
+		humanTaskSlotKey("wf/t", true, "ann"):  true,
+	}
+	if len(keys) != 3 {
+		t.Errorf("slot keys collide: %v", keys)
+	}
+	// A delegated assignment keeps the key of its original approver
+	if humanTaskSlotKey("wf/t", false, humanTaskPrincipal("ann", "bob")) != humanTaskSlotKey("wf/t", false, "ann") {
+		t.Error("delegation changed the slot key")
+	}
+}
+
+func TestAddTypedRejectsUnregisteredPayloads(t *testing.T) {
+	type refundV1 struct{ ChargeID string }
+	type refundV2 struct{ ChargeID, Currency string }
+
+	s := &SagaFramework{
+		name:     "typed-test",
+		registry: make(map[string]SagaCompensationFunc),
+		schemas:  make(map[string]*sagaSchema),
+		log:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	RegisterTyped(s, "refund", 2, func(rc restate.RunContext, p refundV2) error { return nil })
+
+	if err := AddTyped(s, "refund", refundV1{ChargeID: "ch_1"}, true); err == nil || !strings.Contains(err.Error(), "refundV2") {
+		t.Errorf("AddTyped with the wrong payload type: err = %v", err)
+	}
+	if err := AddTyped(s, "ship", refundV2{}, true); err == nil || !strings.Contains(err.Error(), "no typed compensation") {
+		t.Errorf("AddTyped without a registration: err = %v", err)
+	}
+}
+
+func TestIterationStride(t *testing.T) {
+	tests := []struct {
+		total int
+		want  int
+	}{
+		{total: 0, want: progressIterationStride},
+		{total: -1, want: progressIterationStride},
+		{total: 1, want: 1},
+		{total: 39, want: 1},
+		{total: 40, want: 2},
+		{total: 100, want: 5},
+		{total: 10000, want: 500},
+	}
+	for _, tt := range tests {
+		if got := iterationStride(tt.total); got != tt.want {
+			t.Errorf("iterationStride(%d) = %d, want %d", tt.total, got, tt.want)
+		}
+	}
+}